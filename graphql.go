@@ -0,0 +1,53 @@
+package nautobotor
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/jakubjastrabik/nautobotor/nautobot"
+)
+
+// graphQLPath is path of nautobot GraphQL API
+const graphQLPath = "/api/graphql/"
+
+// graphQLURL returns GraphQL API of the nautobot serving REST API at nautobotURL,
+// path prefix of nautobot served under sub-path is kept
+func graphQLURL(nautobotURL string) (string, error) {
+	u, err := url.Parse(nautobotURL)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := ""
+	if i := strings.Index(u.Path, "/api/"); i >= 0 {
+		prefix = u.Path[:i]
+	}
+
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: prefix + graphQLPath}).String(), nil
+}
+
+// getGraphQLData load all IP addresses by single GraphQL query
+func (n *Nautobotor) getGraphQLData() (*nautobot.APIIPaddress, error) {
+	body, err := json.Marshal(nautobot.GraphQLRequest{Query: n.GraphQLQuery})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := n.stopContext()
+	defer cancel()
+
+	payload, err := n.apiClient().Post(ctx, n.GraphQLURL, body)
+	if err != nil {
+		log.Errorf("Error on graphql response err=%s\n", err)
+		return nil, err
+	}
+
+	ip, err := nautobot.NewGraphQLaddress(payload)
+	if err != nil {
+		return nil, err
+	}
+	reportInvalid(ip)
+
+	return ip, nil
+}
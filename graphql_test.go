@@ -0,0 +1,183 @@
+package nautobotor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/jakubjastrabik/nautobotor/nautobot"
+)
+
+// newGraphQLServer start fake nautobot GraphQL API returning response
+func newGraphQLServer(t *testing.T, query, response string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != graphQLPath {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Token abc" {
+			t.Errorf("Unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+
+		var req nautobot.GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Query != query {
+			t.Errorf("Unexpected query %q, err=%v", req.Query, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+}
+
+func TestGraphQL(t *testing.T) {
+	response := `{"data": {"ip_addresses": [
+		{"address": "10.25.25.1/24", "dns_name": "a.graphql.test", "ip_version": 4, "status": {"name": "Active"},
+		 "parent": {"prefix": "10.25.25.0/24"}, "role": null, "tags": [{"name": "cname:www.graphql.test"}],
+		 "_custom_field_data": {"dns_txt": "graphql"}},
+		{"address": "2001:db8::25/64", "dns_name": "b.graphql.test", "ip_version": 6, "status": {"name": "Active"}, "tags": [], "_custom_field_data": {}},
+		{"address": "10.25.25.3/24", "dns_name": "c.graphql.test", "ip_version": 4, "status": {"name": "Reserved"}, "tags": [], "_custom_field_data": {}}
+	]}}`
+	srv := newGraphQLServer(t, nautobot.DefaultGraphQLQuery, response)
+	defer srv.Close()
+
+	c := caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl "+srv.URL+"/api/ipam/ip-addresses/\ntoken abc\ngraphql\n"+
+		testNameServers+"record cname tag cname:\nrecord txt custom_field dns_txt\n}")
+	n, err := newNautobotor(c)
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+	if n.GraphQLURL != srv.URL+graphQLPath {
+		t.Errorf("Expected GraphQL URL %s, got %s", srv.URL+graphQLPath, n.GraphQLURL)
+	}
+
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+
+	testDNSQuestion(t, n, "A", "a.graphql.test.", "10.25.25.1")
+	testDNSQuestion(t, n, "PTR", "a.graphql.test.", "10.25.25.1")
+	testDNSQuestion(t, n, "A", "www.graphql.test.", "10.25.25.1")
+	if !hasAddress(n, "2001:db8::25") || hasAddress(n, "10.25.25.3") {
+		t.Errorf("Expected only active addresses, got %v", n.RM.Addresses())
+	}
+
+	txt := false
+	for _, rr := range n.RM.Snapshot().M["graphql.test."] {
+		if rr.Header().Name == "a.graphql.test." && rr.String() == "a.graphql.test.\t3600\tIN\tTXT\t\"graphql\"" {
+			txt = true
+		}
+	}
+	if !txt {
+		t.Error("Expected TXT record from custom field data")
+	}
+}
+
+func TestGraphQLFilter(t *testing.T) {
+	response := `{"data": {"ip_addresses": [
+		{"address": "10.25.26.1/24", "dns_name": "a.graphql.test", "ip_version": 4, "status": {"name": "Active"},
+		 "parent": {"id": "p1", "prefix": "10.25.26.0/24", "namespace": {"id": "n1", "name": "Global"}, "vrfs": [{"id": "v1", "name": "core"}]}},
+		{"address": "10.25.26.1/24", "dns_name": "b.graphql.test", "ip_version": 4, "status": {"name": "Active"},
+		 "parent": {"id": "p2", "prefix": "10.25.26.0/24", "namespace": {"id": "n2", "name": "Lab"}, "vrfs": [{"id": "v2", "name": "core"}]}}
+	]}}`
+	srv := newGraphQLServer(t, nautobot.DefaultGraphQLQuery, response)
+	defer srv.Close()
+
+	// GraphQL isn't filtered by nautobot, the plugin checks fields of the default query
+	c := caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl "+srv.URL+"/api/ipam/ip-addresses/\ntoken abc\ngraphql\n"+
+		testNameServers+"filter namespace global\nfilter vrf core\n}")
+	n, err := newNautobotor(c)
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+
+	testDNSQuestion(t, n, "A", "a.graphql.test.", "10.25.26.1")
+	for _, a := range n.RM.Addresses() {
+		if a.DnsName == "b.graphql.test." {
+			t.Errorf("Expected only address of the namespace, got %v", n.RM.Addresses())
+		}
+	}
+}
+
+func TestGraphQLQueryFile(t *testing.T) {
+	query := "query { ip_addresses { address dns_name family } }"
+	file := filepath.Join(t.TempDir(), "query.graphql")
+	if err := ioutil.WriteFile(file, []byte(query), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newGraphQLServer(t, query, `{"data": {"ip_addresses": null}, "errors": [{"message": "Cannot query field"}]}`)
+	defer srv.Close()
+
+	c := caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl "+srv.URL+"\ntoken abc\ngraphql "+file+"\n"+testNameServers+"}")
+	n, err := newNautobotor(c)
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+	if err := n.getApiData(); err == nil {
+		t.Error("Expected error returned by GraphQL query")
+	}
+
+	_, err = newNautobotor(caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl "+srv.URL+"\ngraphql "+file+".missing\n"+testNameServers+"}"))
+	if err == nil {
+		t.Errorf("Expected setup error for missing query file, got %v", err)
+	}
+}
+
+func TestGraphQLURL(t *testing.T) {
+	tests := []struct {
+		nautobotURL string
+		want        string
+	}{
+		{"https://nautobot.test/api/ipam/ip-addresses/", "https://nautobot.test/api/graphql/"},
+		{"https://nautobot.test/nautobot/api/ipam/ip-addresses/?limit=100", "https://nautobot.test/nautobot/api/graphql/"},
+		{"https://nautobot.test:8443", "https://nautobot.test:8443/api/graphql/"},
+	}
+
+	for _, tt := range tests {
+		if got, err := graphQLURL(tt.nautobotURL); err != nil || got != tt.want {
+			t.Errorf("graphQLURL(%s) = %q, %v, want %q", tt.nautobotURL, got, err, tt.want)
+		}
+	}
+}
+
+func TestGraphQLOptions(t *testing.T) {
+	base := "webaddress :0\nnautoboturl https://nautobot.test/api/ipam/ip-addresses/\ntoken abc\n" + testNameServers
+
+	tests := []struct {
+		name    string
+		options string
+		query   string
+		url     string
+		wantErr string
+	}{
+		{name: "Default version", options: "graphql\n", query: nautobot.GraphQLQueryV2, url: "https://nautobot.test/api/graphql/"},
+		{name: "Nautobot 1.x", options: "graphql v1\n", query: nautobot.GraphQLQueryV1, url: "https://nautobot.test/api/graphql/"},
+		{name: "GraphQL URL", options: "graphql v2\ngraphql_url https://graphql.test/nautobot/api/graphql/\n", query: nautobot.GraphQLQueryV2, url: "https://graphql.test/nautobot/api/graphql/"},
+		{name: "Invalid GraphQL URL", options: "graphql\ngraphql_url graphql.test\n", wantErr: "invalid graphql_url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := newNautobotor(caddy.NewTestController("dns", "nautobotor {\n"+base+tt.options+"}"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newNautobotor() error = %v", err)
+			}
+			if n.GraphQLQuery != tt.query || n.GraphQLURL != tt.url {
+				t.Errorf("Expected query %q at %s, got %q at %s", tt.query, tt.url, n.GraphQLQuery, n.GraphQLURL)
+			}
+		})
+	}
+}
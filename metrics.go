@@ -4,6 +4,8 @@ import (
 	"sync"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+	"github.com/miekg/dns"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -17,4 +19,136 @@ var requestCount = prometheus.NewCounterVec(prometheus.CounterOpts{
 	Help:      "Counter of requests made.",
 }, []string{"server"})
 
+// resyncCount exports a prometheus metric that is incremented for every record
+// added, removed or changed by the periodic resync with nautobot.
+var resyncCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "resync_changes_total",
+	Help:      "Counter of records changed by resync with nautobot.",
+}, []string{"type"})
+
+// webhookAuthFailures exports a prometheus metric that is incremented every time
+// a webhook is rejected because of missing or invalid signature.
+var webhookAuthFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "webhook_auth_failures_total",
+	Help:      "Counter of webhooks rejected because of invalid signature.",
+})
+
+// invalidAddresses exports a prometheus metric that is incremented for every
+// IP address loaded from nautobot, which is skipped because of invalid data.
+var invalidAddresses = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "invalid_addresses_total",
+	Help:      "Counter of IP addresses loaded from nautobot skipped because of invalid data.",
+})
+
+// queryCount exports a prometheus metric that is incremented every time a query
+// for the zone is answered by the nautobotor plugin.
+var queryCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "queries_total",
+	Help:      "Counter of queries per zone.",
+}, []string{"server", "zone"})
+
+// nxdomainCount exports a prometheus metric that is incremented every time
+// NXDOMAIN is returned for the zone.
+var nxdomainCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "nxdomain_total",
+	Help:      "Counter of NXDOMAIN responses per zone.",
+}, []string{"server", "zone"})
+
+// nodataCount exports a prometheus metric that is incremented every time
+// NODATA is returned for the zone.
+var nodataCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "nodata_total",
+	Help:      "Counter of NODATA responses per zone.",
+}, []string{"server", "zone"})
+
+// zonesCount exports a prometheus metric with number of zones served.
+var zonesCount = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "zones",
+	Help:      "Number of zones served.",
+})
+
+// recordsCount exports a prometheus metric with number of records per zone and type.
+var recordsCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "records",
+	Help:      "Number of records per zone and type.",
+}, []string{"zone", "type"})
+
+// webhookCount exports a prometheus metric that is incremented for every webhook
+// received, labeled by the event and outcome of the processing.
+var webhookCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "webhook_events_total",
+	Help:      "Counter of webhook events by event type and outcome.",
+}, []string{"event", "outcome"})
+
+// syncDuration exports a prometheus metric with duration of full sync with nautobot API.
+var syncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "sync_duration_seconds",
+	Help:      "Histogram of the time full sync with nautobot API took.",
+	Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+})
+
+// lastSync exports a prometheus metric with time of the last successful sync with nautobot.
+var lastSync = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "nautobotor",
+	Name:      "last_sync_timestamp_seconds",
+	Help:      "Timestamp of the last successful sync with nautobot.",
+})
+
+// zoneTypes remembers record types exported per zone, so gauge
+// of the type removed from the zone can be dropped
+var zoneTypes = struct {
+	sync.Mutex
+	m map[string]map[string]bool
+}{m: make(map[string]map[string]bool)}
+
+// updateZoneMetrics export number of zones and records in changed zones
+func updateZoneMetrics(rm *ramrecords.RamRecord, zones []string) {
+	snap := rm.Snapshot()
+
+	zoneTypes.Lock()
+	defer zoneTypes.Unlock()
+
+	zonesCount.Set(float64(len(snap.Zones)))
+	for _, zone := range zones {
+		count := make(map[string]int)
+		for _, rr := range snap.M[zone] {
+			count[dns.TypeToString[rr.Header().Rrtype]]++
+		}
+
+		for t := range zoneTypes.m[zone] {
+			if _, ok := count[t]; !ok {
+				recordsCount.DeleteLabelValues(zone, t)
+			}
+		}
+
+		types := make(map[string]bool, len(count))
+		for t, c := range count {
+			recordsCount.WithLabelValues(zone, t).Set(float64(c))
+			types[t] = true
+		}
+		zoneTypes.m[zone] = types
+	}
+}
+
 var once sync.Once
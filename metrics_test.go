@@ -0,0 +1,187 @@
+package nautobotor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/jakubjastrabik/nautobotor/nautobot"
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// syncCount returns number of observed syncs
+func syncCount(t *testing.T) uint64 {
+	var m dto.Metric
+	if err := syncDuration.Write(&m); err != nil {
+		t.Fatalf("Unable read sync duration error = %s", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestZoneMetrics(t *testing.T) {
+	n := newTestNautobotor(t, ramrecords.Config{
+		Default: ramrecords.ZoneConfig{NS: []ramrecords.NameServer{{Name: "ns1"}}},
+	})
+	// Gauges of other tests and previous runs
+	recordsCount.Reset()
+	rm := n.RM
+	rm.OnChange(func(zones []string) { updateZoneMetrics(rm, zones) })
+
+	n.addAddress(4, "10.15.15.1/24", "a.metrics.test")
+	n.addAddress(4, "10.15.15.2/24", "b.metrics.test")
+
+	if got := testutil.ToFloat64(zonesCount); got != 2 {
+		t.Errorf("Expected 2 zones, got %v", got)
+	}
+	if got := testutil.ToFloat64(recordsCount.WithLabelValues("metrics.test.", "A")); got != 2 {
+		t.Errorf("Expected 2 A records, got %v", got)
+	}
+	if got := testutil.ToFloat64(recordsCount.WithLabelValues("15.15.10.in-addr.arpa.", "PTR")); got != 2 {
+		t.Errorf("Expected 2 PTR records, got %v", got)
+	}
+
+	n.removeAddress(4, "10.15.15.1/24", "a.metrics.test")
+	if got := testutil.ToFloat64(recordsCount.WithLabelValues("metrics.test.", "A")); got != 1 {
+		t.Errorf("Expected 1 A record after remove, got %v", got)
+	}
+
+	// Gauge of the type removed from the zone is dropped
+	n.removeAddress(4, "10.15.15.2/24", "b.metrics.test")
+	if got := testutil.CollectAndCount(recordsCount); got != 4 {
+		t.Errorf("Expected only SOA and NS gauges of 2 zones, got %d", got)
+	}
+}
+
+func TestQueryMetrics(t *testing.T) {
+	n := Nautobotor{RM: ramrecords.New()}
+	n.addAddress(4, "10.16.16.1/24", "a.query.test")
+
+	queries := testutil.ToFloat64(queryCount.WithLabelValues("", "query.test."))
+	nxdomain := testutil.ToFloat64(nxdomainCount.WithLabelValues("", "query.test."))
+	nodata := testutil.ToFloat64(nodataCount.WithLabelValues("", "query.test."))
+
+	for _, q := range []struct {
+		name  string
+		qtype uint16
+	}{
+		{"a.query.test.", dns.TypeA},
+		{"a.query.test.", dns.TypeMX},
+		{"missing.query.test.", dns.TypeA},
+	} {
+		r := new(dns.Msg)
+		r.SetQuestion(q.name, q.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := n.ServeDNS(context.TODO(), rec, r); err != nil {
+			t.Fatalf("ServeDNS() error = %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(queryCount.WithLabelValues("", "query.test.")) - queries; got != 3 {
+		t.Errorf("Expected 3 queries, got %v", got)
+	}
+	if got := testutil.ToFloat64(nxdomainCount.WithLabelValues("", "query.test.")) - nxdomain; got != 1 {
+		t.Errorf("Expected 1 NXDOMAIN, got %v", got)
+	}
+	if got := testutil.ToFloat64(nodataCount.WithLabelValues("", "query.test.")) - nodata; got != 1 {
+		t.Errorf("Expected 1 NODATA, got %v", got)
+	}
+}
+
+func TestWebhookMetrics(t *testing.T) {
+	n := Nautobotor{RM: ramrecords.New(), WebhookSecret: "secret"}
+
+	created := `{"event": "created", "model": "ipaddress", "data": {"family": {"value": 4}, "address": "10.17.17.1/24", "dns_name": "a.hook.test"}}`
+
+	tests := []struct {
+		name    string
+		method  string
+		payload string
+		sign    bool
+		event   string
+		outcome string
+	}{
+		{name: "Wrong method", method: http.MethodGet, event: "unknown", outcome: "method_not_allowed"},
+		{name: "Invalid signature", method: http.MethodPost, payload: created, event: "unknown", outcome: "unauthorized"},
+		{name: "Malformed payload", method: http.MethodPost, payload: `{"event": `, sign: true, event: "unknown", outcome: "malformed"},
+		{name: "Unsupported event", method: http.MethodPost, payload: `{"event": "moved"}`, sign: true, event: "other", outcome: "unsupported"},
+		{name: "Created", method: http.MethodPost, payload: created, sign: true, event: "created", outcome: "success"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := webhookCount.WithLabelValues(tt.event, tt.outcome)
+			before := testutil.ToFloat64(c)
+
+			req := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.payload))
+			if tt.sign {
+				mac := hmac.New(sha512.New, []byte("secret"))
+				mac.Write([]byte(tt.payload))
+				req.Header.Set(nautobot.SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+			}
+			n.handleWebhook(httptest.NewRecorder(), req)
+
+			if got := testutil.ToFloat64(c) - before; got != 1 {
+				t.Errorf("Expected webhook counted as %s/%s, got %v", tt.event, tt.outcome, got)
+			}
+		})
+	}
+}
+
+func TestSyncMetrics(t *testing.T) {
+	srv := newNautobotServer(t, []nautobot.Results{
+		{Family: nautobot.Family{Value: 4}, Address: "10.18.18.1/24", Dns_name: "a.sync.test."},
+	}, 50)
+	defer srv.Close()
+
+	n := Nautobotor{NautobotURL: srv.URL, RM: ramrecords.New()}
+
+	before := syncCount(t)
+	lastSync.Set(0)
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+	if err := n.resync(); err != nil {
+		t.Fatalf("Nautobotor.resync() error = %v", err)
+	}
+
+	if got := syncCount(t) - before; got != 2 {
+		t.Errorf("Expected 2 observed syncs, got %d", got)
+	}
+	if testutil.ToFloat64(lastSync) == 0 {
+		t.Error("Expected last sync timestamp to be set")
+	}
+}
+
+func TestInvalidAddressesMetric(t *testing.T) {
+	srv := newNautobotServer(t, []nautobot.Results{
+		{Family: nautobot.Family{Value: 4}, Address: "10.19.19.1/24", Dns_name: "a.invalid.test."},
+		{Family: nautobot.Family{Value: 4}, Address: "10.19.19.2/24", Dns_name: "bad..invalid.test."},
+		{Address: "2001:db8::19/64", Dns_name: "c.invalid.test."},
+	}, 50)
+	defer srv.Close()
+
+	n := Nautobotor{NautobotURL: srv.URL, RM: ramrecords.New()}
+
+	before := testutil.ToFloat64(invalidAddresses)
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+
+	// Invalid address doesn't prevent loading the others
+	if got := testutil.ToFloat64(invalidAddresses) - before; got != 1 {
+		t.Errorf("Expected 1 invalid address, got %v", got)
+	}
+	if !hasAddress(n, "10.19.19.1") || !hasAddress(n, "2001:db8::19") || hasAddress(n, "10.19.19.2") {
+		t.Errorf("Expected only valid addresses loaded, got %v", n.RM.Addresses())
+	}
+}
@@ -2,32 +2,52 @@ package nautobot
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
 )
 
 type Results struct {
-	Family   Family `json:"family"`
-	Address  string `json:"address"`
-	Status   Status `json:"status"`
-	Dns_name string `json:"dns_name"`
+	Family        Family                 `json:"family"`
+	Address       string                 `json:"address"`
+	Status        Status                 `json:"status"`
+	Dns_name      string                 `json:"dns_name"`
+	Tags          Tags                   `json:"tags,omitempty"`
+	Custom_fields map[string]interface{} `json:"custom_fields,omitempty"`
+	Parent        *Ref                   `json:"parent,omitempty"`
+	Vrf           *Ref                   `json:"vrf,omitempty"`
+	Tenant        *Ref                   `json:"tenant,omitempty"`
+	Role          *Ref                   `json:"role,omitempty"`
 }
 
 // IPaddress is structure for pars webhook intput data
 type APIIPaddress struct {
-	Count   int `json:"count"`
+	Count   int    `json:"count"`
+	Next    string `json:"next"`
 	Event   string
 	Results []Results `json:"results"`
+	Invalid []error   `json:"-"` // Invalid IP addresses skipped from Results
 }
 
-// NewIPaddress Unmarshal input byte to json struct
-func NewAPIaddress(payload []byte) *APIIPaddress {
+// NewAPIaddress Unmarshal page of nautobot API to json struct,
+// invalid IP addresses are skipped and reported in Invalid
+func NewAPIaddress(payload []byte) (*APIIPaddress, error) {
 	var ip_add APIIPaddress
 	ip_add.Event = "created"
 
 	err := json.Unmarshal(payload, &ip_add)
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
+	if ip_add.Results == nil {
+		return nil, fmt.Errorf("%w: missing results", ErrInvalidData)
+	}
+
+	// Nautobot 2.x returns ip_version instead of family
+	for i := range ip_add.Results {
+		if ip_add.Results[i].Family.Value == 0 {
+			ip_add.Results[i].Family.Value = addressFamily(ip_add.Results[i].Address)
+		}
+	}
+	ip_add.Results, ip_add.Invalid = validResults(ip_add.Results)
 
-	return &ip_add
+	return &ip_add, nil
 }
@@ -0,0 +1,217 @@
+package nautobot
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client defaults, used when they aren't configured
+const (
+	DefaultTimeout   = 30 * time.Second
+	DefaultRetries   = 3
+	DefaultBackoff   = time.Second
+	DefaultUserAgent = "nautobotor"
+	MaxRetryAfter    = 5 * time.Minute // Longest Retry-After delay honoured
+)
+
+// ClientConfig holds options of the nautobot API client
+type ClientConfig struct {
+	Token     string
+	Timeout   time.Duration // Timeout of single request
+	Retries   int           // Retries of 429 and 5xx responses and network errors, -1 disable retries
+	Backoff   time.Duration // Delay before first retry, doubled with every retry
+	CAFile    string        // PEM bundle of CAs used to verify nautobot, system CAs if empty
+	CertFile  string        // PEM client certificate used for mTLS
+	KeyFile   string        // PEM key of the client certificate
+	Proxy     string        // Proxy URL, proxy from environment if empty
+	UserAgent string
+}
+
+// Client is HTTP client of nautobot API
+type Client struct {
+	token     string
+	retries   int
+	backoff   time.Duration
+	userAgent string
+	http      *http.Client
+}
+
+// StatusError is returned when nautobot answers with unexpected status code
+type StatusError struct {
+	Code       int
+	Status     string
+	RetryAfter time.Duration // Delay requested by Retry-After header, 0 if missing
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected response status " + e.Status
+}
+
+// NewClient returns client configured by cfg, defaults are used for missing options
+func NewClient(cfg ClientConfig) (*Client, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = DefaultRetries
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultBackoff
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable read CA bundle: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %s", cfg.CAFile)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable load client certificate: %s", err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %s", cfg.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &Client{
+		token:     cfg.Token,
+		retries:   cfg.Retries,
+		backoff:   cfg.Backoff,
+		userAgent: cfg.UserAgent,
+		http:      &http.Client{Timeout: cfg.Timeout, Transport: transport},
+	}, nil
+}
+
+// Get send GET request to nautobot API, return body of successful response
+func (c *Client) Get(ctx context.Context, url string) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, url, nil)
+}
+
+// Post send POST request with JSON body to nautobot API, return body of successful response
+func (c *Client) Post(ctx context.Context, url string, body []byte) ([]byte, error) {
+	return c.do(ctx, http.MethodPost, url, body)
+}
+
+// do send the request, 429 and 5xx responses and network errors are retried
+// with exponential backoff or after delay requested by nautobot, other errors
+// are returned immediately. Waiting for retry is interrupted by ctx.
+func (c *Client) do(ctx context.Context, method, url string, body []byte) ([]byte, error) {
+	backoff := c.backoff
+
+	for attempt := 0; ; attempt++ {
+		payload, err := c.send(ctx, method, url, body)
+		if err == nil {
+			return payload, nil
+		}
+
+		delay := backoff
+		var se *StatusError
+		if errors.As(err, &se) {
+			if !retryable(se.Code) {
+				return nil, err
+			}
+			if se.RetryAfter > 0 {
+				delay = se.RetryAfter
+			}
+		}
+		if attempt >= c.retries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// retryable check if request answered with the code can be retried
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// retryAfter returns delay of Retry-After header given as seconds or HTTP date,
+// delay is limited by MaxRetryAfter
+func retryAfter(h string) time.Duration {
+	var d time.Duration
+	if s, err := strconv.Atoi(h); err == nil {
+		d = time.Duration(s) * time.Second
+	} else if t, err := http.ParseTime(h); err == nil {
+		d = time.Until(t)
+	}
+
+	switch {
+	case d < 0:
+		return 0
+	case d > MaxRetryAfter:
+		return MaxRetryAfter
+	}
+	return d
+}
+
+// send single request
+func (c *Client) send(ctx context.Context, method, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Token "+c.token)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	payload, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status, RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,261 @@
+package nautobot
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newStatusServer start server answering with codes, the last code is repeated
+func newStatusServer(t *testing.T, requests *int32, codes ...int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(requests, 1)) - 1
+		if i >= len(codes) {
+			i = len(codes) - 1
+		}
+		w.WriteHeader(codes[i])
+		w.Write([]byte(`{"count": 0}`))
+	}))
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []int // Response codes of subsequent requests
+		retries  int
+		requests int32
+		wantErr  bool
+	}{
+		{name: "Success", codes: []int{200}, requests: 1},
+		{name: "Retry server error", codes: []int{500, 503, 200}, requests: 3},
+		{name: "Retries exhausted", codes: []int{502, 502, 502}, retries: 2, requests: 3, wantErr: true},
+		{name: "Retries disabled", codes: []int{502}, retries: -1, requests: 1, wantErr: true},
+		{name: "Client error fails fast", codes: []int{404}, requests: 1, wantErr: true},
+		{name: "Unauthorized fails fast", codes: []int{403, 200}, requests: 1, wantErr: true},
+		{name: "Retry too many requests", codes: []int{429, 200}, requests: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			srv := newStatusServer(t, &requests, tt.codes...)
+			defer srv.Close()
+
+			c, err := NewClient(ClientConfig{Retries: tt.retries, Backoff: time.Millisecond})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			_, err = c.Get(context.Background(), srv.URL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if requests != tt.requests {
+				t.Errorf("Expected %d requests, got %d", tt.requests, requests)
+			}
+
+			var se *StatusError
+			if tt.wantErr && (!errors.As(err, &se) || se.Code != tt.codes[tt.requests-1]) {
+				t.Errorf("Expected StatusError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClientNetworkError(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			panic(http.ErrAbortHandler)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := c.Get(context.Background(), srv.URL); err != nil {
+		t.Errorf("Client.Get() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected retry after network error, got %d requests", requests)
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Token abc" {
+			t.Errorf("Unexpected authorization %q", got)
+		}
+		if got := r.Header.Get("User-Agent"); got != "nautobotor/v1.0.0" {
+			t.Errorf("Unexpected User-Agent %q", got)
+		}
+		if r.Method == http.MethodPost && r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected Content-Type %q", r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientConfig{Token: "abc", UserAgent: "nautobotor/v1.0.0"})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := c.Get(context.Background(), srv.URL); err != nil {
+		t.Errorf("Client.Get() error = %v", err)
+	}
+
+	// Body is sent again with every retry
+	payload, err := c.Post(context.Background(), srv.URL, []byte(`{"query": "q"}`))
+	if err != nil || string(payload) != `{"query": "q"}` {
+		t.Errorf("Client.Post() = %s, %v", payload, err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	c, err := NewClient(ClientConfig{Timeout: 50 * time.Millisecond, Retries: -1})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := c.Get(context.Background(), srv.URL); err == nil {
+		t.Error("Expected timeout error")
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	// Self signed certificate isn't trusted without CA bundle
+	c, err := NewClient(ClientConfig{Retries: -1})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := c.Get(context.Background(), srv.URL); err == nil {
+		t.Error("Expected error of untrusted certificate")
+	}
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(ca, cert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = NewClient(ClientConfig{CAFile: ca, Retries: -1})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := c.Get(context.Background(), srv.URL); err != nil {
+		t.Errorf("Client.Get() error = %v", err)
+	}
+}
+
+func TestNewClientErrors(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := ioutil.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  ClientConfig
+	}{
+		{name: "Missing CA bundle", cfg: ClientConfig{CAFile: empty + ".missing"}},
+		{name: "Empty CA bundle", cfg: ClientConfig{CAFile: empty}},
+		{name: "Missing client certificate", cfg: ClientConfig{CertFile: empty + ".missing", KeyFile: empty}},
+		{name: "Missing client key", cfg: ClientConfig{CertFile: empty}},
+		{name: "Invalid proxy", cfg: ClientConfig{Proxy: "proxy.test:3128"}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewClient(tt.cfg); err == nil {
+			t.Errorf("%s: expected NewClient() error", tt.name)
+		}
+	}
+
+	if _, err := NewClient(ClientConfig{Proxy: "http://proxy.test:3128"}); err != nil {
+		t.Errorf("NewClient() unexpected proxy error = %v", err)
+	}
+}
+
+func TestClientRetryAfter(t *testing.T) {
+	var requests int32
+	var first time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if d := time.Since(first); d < time.Second {
+			t.Errorf("Retried after %s, before Retry-After", d)
+		}
+		w.Write([]byte(`{"count": 0}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(ClientConfig{Backoff: time.Millisecond})
+	if _, err := c.Get(context.Background(), srv.URL); err != nil || requests != 2 {
+		t.Errorf("Client.Get() error = %v after %d requests", err, requests)
+	}
+}
+
+func TestClientCanceled(t *testing.T) {
+	var requests int32
+	srv := newStatusServer(t, &requests, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	c, _ := NewClient(ClientConfig{Backoff: time.Hour})
+
+	// Waiting for retry is interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := c.Get(ctx, srv.URL); err == nil {
+		t.Error("Expected error of canceled request")
+	}
+	if d := time.Since(start); d > 5*time.Second || requests != 1 {
+		t.Errorf("Expected single request canceled during backoff, got %d requests in %s", requests, d)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{"86400", MaxRetryAfter},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+
+	for _, tt := range tests {
+		if got := retryAfter(tt.header); got != tt.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
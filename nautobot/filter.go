@@ -0,0 +1,162 @@
+package nautobot
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// FilterKeys are nautobot filters limiting published IP addresses
+var FilterKeys = map[string]bool{
+	"tag":       true,
+	"tenant":    true,
+	"vrf":       true,
+	"namespace": true,
+	"role":      true,
+	"parent":    true,
+}
+
+// Ref is nested nautobot object, serialized as object or as plain name
+type Ref struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Slug      string `json:"slug,omitempty"`
+	Display   string `json:"display,omitempty"`
+	Value     string `json:"value,omitempty"`  // Choice field, e.g. role in nautobot 1.x
+	Prefix    string `json:"prefix,omitempty"` // Parent prefix
+	Namespace *Ref   `json:"namespace,omitempty"`
+	Vrfs      []Ref  `json:"vrfs,omitempty"` // VRFs of parent prefix in nautobot 2.x
+}
+
+// UnmarshalJSON accept object, or plain name returned by GraphQL for choice fields
+func (r *Ref) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &r.Name); err == nil {
+		return nil
+	}
+
+	type ref Ref
+	return json.Unmarshal(b, (*ref)(r))
+}
+
+// Matches check if value is ID, name, slug, display name, choice value or prefix of the object
+func (r *Ref) Matches(value string) bool {
+	if r == nil {
+		return false
+	}
+	for _, v := range []string{r.ID, r.Name, r.Slug, r.Display, r.Value, r.Prefix} {
+		if v != "" && strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter limits published IP addresses to the scope of the instance,
+// address must match all keys and any value of the key
+type Filter map[string][]string
+
+// Add values of the key to the filter
+func (f Filter) Add(key string, values ...string) {
+	f[key] = append(f[key], values...)
+}
+
+// Apply append the filter to query of nautobot API URL
+func (f Filter) Apply(apiURL string) (string, error) {
+	if len(f) == 0 {
+		return apiURL, nil
+	}
+
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, v := range f[key] {
+			q.Add(key, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// MatchData check if webhook data are in scope of the filter
+func (f Filter) MatchData(d Data) bool {
+	return f.match(scope{address: d.Address, tags: d.Tags, parent: d.Parent, vrf: d.Vrf, tenant: d.Tenant, role: d.Role})
+}
+
+// MatchResults check if API result is in scope of the filter
+func (f Filter) MatchResults(r Results) bool {
+	return f.match(scope{address: r.Address, tags: r.Tags, parent: r.Parent, vrf: r.Vrf, tenant: r.Tenant, role: r.Role})
+}
+
+// scope are the IP address data checked by the filter
+type scope struct {
+	address                   string
+	tags                      Tags
+	parent, vrf, tenant, role *Ref
+}
+
+func (f Filter) match(s scope) bool {
+	for key, values := range f {
+		if !s.matchAny(key, values) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny check if any value of the key matches
+func (s scope) matchAny(key string, values []string) bool {
+	for _, v := range values {
+		if s.matchValue(key, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s scope) matchValue(key, value string) bool {
+	switch key {
+	case "tag":
+		for _, t := range s.tags {
+			if (&Ref{ID: t.ID, Name: t.Name, Slug: t.Slug}).Matches(value) {
+				return true
+			}
+		}
+		return false
+	case "tenant":
+		return s.tenant.Matches(value)
+	case "vrf":
+		// Address of nautobot 2.x is in VRFs of its parent prefix
+		if s.parent != nil {
+			for i := range s.parent.Vrfs {
+				if s.parent.Vrfs[i].Matches(value) {
+					return true
+				}
+			}
+		}
+		return s.vrf.Matches(value)
+	case "role":
+		return s.role.Matches(value)
+	case "namespace":
+		return s.parent != nil && s.parent.Namespace.Matches(value)
+	case "parent":
+		// Parent given as prefix contains the address, as in nautobot 1.x
+		if _, prefix, err := net.ParseCIDR(value); err == nil {
+			ip, _, err := net.ParseCIDR(s.address)
+			return err == nil && prefix.Contains(ip)
+		}
+		return s.parent.Matches(value)
+	default:
+		return false
+	}
+}
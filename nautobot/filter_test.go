@@ -0,0 +1,96 @@
+package nautobot
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestFilterApply(t *testing.T) {
+	f := make(Filter)
+	f.Add("tag", "dns", "prod")
+	f.Add("vrf", "core")
+
+	got, err := f.Apply("https://nautobot.test/api/ipam/ip-addresses/?limit=100")
+	if err != nil {
+		t.Fatalf("Filter.Apply() error = %v", err)
+	}
+	u, _ := url.Parse(got)
+	want := url.Values{"limit": {"100"}, "tag": {"dns", "prod"}, "vrf": {"core"}}
+	if u.Path != "/api/ipam/ip-addresses/" || u.Query().Encode() != want.Encode() {
+		t.Errorf("Filter.Apply() = %s, want query %s", got, want.Encode())
+	}
+
+	// Empty filter doesn't change URL
+	if got, _ := Filter(nil).Apply("https://nautobot.test/api/"); got != "https://nautobot.test/api/" {
+		t.Errorf("Filter.Apply() = %s", got)
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	var d Data
+	payload := `{"address": "10.30.1.5/24", "dns_name": "a.filter.test",
+		"tags": [{"id": "a1", "name": "DNS Prod", "slug": "dns-prod"}],
+		"tenant": {"id": "t1", "name": "Acme", "slug": "acme"},
+		"vrf": {"id": "v1", "name": "core"},
+		"role": {"value": "loopback", "label": "Loopback"},
+		"parent": {"id": "p1", "prefix": "10.30.1.0/24", "namespace": {"name": "Global"}}}`
+	if err := json.Unmarshal([]byte(payload), &d); err != nil {
+		t.Fatalf("Unable unmarshal data: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "Empty filter", filter: Filter{}, want: true},
+		{name: "Tag name", filter: Filter{"tag": {"dns prod"}}, want: true},
+		{name: "Tag slug", filter: Filter{"tag": {"dns-prod"}}, want: true},
+		{name: "Tag ID", filter: Filter{"tag": {"a1"}}, want: true},
+		{name: "Other tag", filter: Filter{"tag": {"lab"}}, want: false},
+		{name: "Any value", filter: Filter{"tenant": {"other", "acme"}}, want: true},
+		{name: "VRF", filter: Filter{"vrf": {"core"}}, want: true},
+		{name: "Role choice", filter: Filter{"role": {"loopback"}}, want: true},
+		{name: "Namespace", filter: Filter{"namespace": {"global"}}, want: true},
+		{name: "Parent prefix contains address", filter: Filter{"parent": {"10.30.0.0/16"}}, want: true},
+		{name: "Parent prefix without address", filter: Filter{"parent": {"10.31.0.0/16"}}, want: false},
+		{name: "Parent ID", filter: Filter{"parent": {"p1"}}, want: true},
+		{name: "All keys", filter: Filter{"vrf": {"core"}, "tenant": {"acme"}}, want: true},
+		{name: "One key not matching", filter: Filter{"vrf": {"core"}, "tenant": {"other"}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.MatchData(d); got != tt.want {
+				t.Errorf("Filter.MatchData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Missing object doesn't match
+	r := Results{Address: "10.30.1.6/24", Vrf: &Ref{Name: "lab"}}
+	if (Filter{"tenant": {"acme"}}).MatchResults(r) || !(Filter{"vrf": {"lab"}}).MatchResults(r) {
+		t.Errorf("Unexpected match of %+v", r)
+	}
+
+	// Address of nautobot 2.x is in VRFs of its parent prefix
+	r = Results{Address: "10.30.1.7/24", Parent: &Ref{ID: "p1", Vrfs: []Ref{{ID: "v2", Name: "lab"}}}}
+	if !(Filter{"vrf": {"lab"}}).MatchResults(r) || (Filter{"vrf": {"core"}}).MatchResults(r) {
+		t.Errorf("Unexpected match of parent VRFs %+v", r.Parent)
+	}
+}
+
+func TestRefUnmarshal(t *testing.T) {
+	var r struct {
+		Role   *Ref `json:"role"`
+		Tenant *Ref `json:"tenant"`
+		Vrf    *Ref `json:"vrf"`
+	}
+	if err := json.Unmarshal([]byte(`{"role": "LOOPBACK", "tenant": {"name": "Acme"}, "vrf": null}`), &r); err != nil {
+		t.Fatalf("Unable unmarshal refs: %v", err)
+	}
+	if !r.Role.Matches("loopback") || !r.Tenant.Matches("acme") || r.Vrf.Matches("") {
+		t.Errorf("Unexpected refs %+v %+v %+v", r.Role, r.Tenant, r.Vrf)
+	}
+}
@@ -0,0 +1,109 @@
+package nautobot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GraphQLQueryV1 loads all IP addresses with the data used to generate records from nautobot 1.x
+const GraphQLQueryV1 = `query {
+  ip_addresses {
+    address
+    dns_name
+    family
+    status { slug }
+    vrf { id name }
+    tenant { id name slug }
+    role
+    tags { id name slug }
+    _custom_field_data
+  }
+}`
+
+// GraphQLQueryV2 loads all IP addresses with the data used to generate records from nautobot 2.x
+const GraphQLQueryV2 = `query {
+  ip_addresses {
+    address
+    dns_name
+    ip_version
+    status { name }
+    parent { id prefix namespace { id name } vrfs { id name } }
+    tenant { id name }
+    role { id name }
+    tags { id name }
+    _custom_field_data
+  }
+}`
+
+// GraphQLQueries are built-in queries by nautobot version
+var GraphQLQueries = map[string]string{
+	"v1": GraphQLQueryV1,
+	"v2": GraphQLQueryV2,
+}
+
+// DefaultGraphQLQuery is query used when nautobot version isn't given
+const DefaultGraphQLQuery = GraphQLQueryV2
+
+// GraphQLRequest is body of request sent to nautobot GraphQL API
+type GraphQLRequest struct {
+	Query string `json:"query"`
+}
+
+// graphQLAddress is IP address returned by GraphQL query,
+// custom fields are returned as _custom_field_data
+type graphQLAddress struct {
+	Results
+	Custom_field_data map[string]interface{} `json:"_custom_field_data"`
+}
+
+// graphQLResponse is response of nautobot GraphQL API
+type graphQLResponse struct {
+	Data struct {
+		IPAddresses []graphQLAddress `json:"ip_addresses"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// NewGraphQLaddress Unmarshal GraphQL response to the same structure as REST API data
+func NewGraphQLaddress(payload []byte) (*APIIPaddress, error) {
+	var resp graphQLResponse
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Errors) > 0 {
+		msgs := make([]string, 0, len(resp.Errors))
+		for _, e := range resp.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return nil, errors.New("graphql: " + strings.Join(msgs, "; "))
+	}
+	if resp.Data.IPAddresses == nil {
+		return nil, fmt.Errorf("%w: missing ip_addresses", ErrInvalidData)
+	}
+
+	ip_add := &APIIPaddress{
+		Count:   len(resp.Data.IPAddresses),
+		Event:   "created",
+		Results: make([]Results, 0, len(resp.Data.IPAddresses)),
+	}
+	for _, a := range resp.Data.IPAddresses {
+		r := a.Results
+		if r.Custom_fields == nil {
+			r.Custom_fields = a.Custom_field_data
+		}
+		// Query may return ip_version instead of family
+		if r.Family.Value == 0 {
+			r.Family.Value = addressFamily(r.Address)
+		}
+		ip_add.Results = append(ip_add.Results, r)
+	}
+
+	ip_add.Results, ip_add.Invalid = validResults(ip_add.Results)
+
+	return ip_add, nil
+}
@@ -0,0 +1,97 @@
+package nautobot
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+// Subset of nautobot GraphQL schemas used by the built-in queries,
+// fields of the type are mapped to their object type, scalars to ""
+var (
+	schemaV1 = map[string]map[string]string{
+		"Query":         {"ip_addresses": "IPAddressType"},
+		"IPAddressType": {"id": "", "address": "", "dns_name": "", "family": "", "status": "StatusType", "role": "", "vrf": "VRFType", "tenant": "TenantType", "tags": "TagType", "_custom_field_data": ""},
+		"StatusType":    {"id": "", "name": "", "slug": ""},
+		"VRFType":       {"id": "", "name": "", "rd": ""},
+		"TenantType":    {"id": "", "name": "", "slug": ""},
+		"TagType":       {"id": "", "name": "", "slug": ""},
+	}
+	schemaV2 = map[string]map[string]string{
+		"Query":         {"ip_addresses": "IPAddressType"},
+		"IPAddressType": {"id": "", "address": "", "dns_name": "", "ip_version": "", "status": "StatusType", "role": "RoleType", "parent": "PrefixType", "tenant": "TenantType", "tags": "TagType", "_custom_field_data": ""},
+		"StatusType":    {"id": "", "name": ""},
+		"RoleType":      {"id": "", "name": ""},
+		"PrefixType":    {"id": "", "prefix": "", "namespace": "NamespaceType", "vrfs": "VRFType"},
+		"NamespaceType": {"id": "", "name": ""},
+		"VRFType":       {"id": "", "name": "", "rd": ""},
+		"TenantType":    {"id": "", "name": ""},
+		"TagType":       {"id": "", "name": ""},
+	}
+)
+
+// graphQLToken matches names and braces of the query
+var graphQLToken = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*|[{}]`)
+
+// checkQuery check that every field selected by the query is in the schema
+func checkQuery(query string, schema map[string]map[string]string) error {
+	tokens := graphQLToken.FindAllString(query, -1)
+	// Skip operation type and name
+	for len(tokens) > 0 && tokens[0] != "{" {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return errors.New("missing selection")
+	}
+
+	_, err := checkSelection(tokens, "Query", schema)
+	return err
+}
+
+// checkSelection check selection set starting by "{" on the type, return tokens after it
+func checkSelection(tokens []string, typ string, schema map[string]map[string]string) ([]string, error) {
+	tokens = tokens[1:]
+	for len(tokens) > 0 && tokens[0] != "}" {
+		field := tokens[0]
+		tokens = tokens[1:]
+
+		child, ok := schema[typ][field]
+		if !ok {
+			return nil, fmt.Errorf("%s has no field %s", typ, field)
+		}
+		selected := len(tokens) > 0 && tokens[0] == "{"
+		switch {
+		case selected && child == "":
+			return nil, fmt.Errorf("scalar %s.%s can't have selection", typ, field)
+		case !selected && child != "":
+			return nil, fmt.Errorf("object %s.%s must have selection", typ, field)
+		case selected:
+			var err error
+			if tokens, err = checkSelection(tokens, child, schema); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("unbalanced braces")
+	}
+	return tokens[1:], nil
+}
+
+func TestGraphQLQueries(t *testing.T) {
+	if err := checkQuery(GraphQLQueryV1, schemaV1); err != nil {
+		t.Errorf("GraphQLQueryV1 doesn't match nautobot 1.x schema: %v", err)
+	}
+	if err := checkQuery(GraphQLQueryV2, schemaV2); err != nil {
+		t.Errorf("GraphQLQueryV2 doesn't match nautobot 2.x schema: %v", err)
+	}
+
+	// Queries are specific to the version
+	if err := checkQuery(GraphQLQueryV1, schemaV2); err == nil {
+		t.Error("Expected GraphQLQueryV1 to fail on nautobot 2.x schema")
+	}
+	if err := checkQuery(GraphQLQueryV2, schemaV1); err == nil {
+		t.Error("Expected GraphQLQueryV2 to fail on nautobot 1.x schema")
+	}
+}
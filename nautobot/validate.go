@@ -0,0 +1,78 @@
+package nautobot
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidData is returned for IP address data which can't be used to generate records
+var ErrInvalidData = errors.New("invalid ip address data")
+
+// dnsNameRegexp is dns_name format accepted by nautobot
+var dnsNameRegexp = regexp.MustCompile(`^([0-9A-Za-z_-]+|\*)(\.[0-9A-Za-z_-]+)*\.?$`)
+
+// Validate check the IP address data, address without DNS name is valid
+func (d Data) Validate() error {
+	if err := validateAddress(d.Family.Value, d.Address, d.Dns_name); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidData, err)
+	}
+	return nil
+}
+
+// Validate check the IP address data, address without DNS name is valid
+func (r Results) Validate() error {
+	if err := validateAddress(r.Family.Value, r.Address, r.Dns_name); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidData, err)
+	}
+	return nil
+}
+
+// validResults returns valid IP addresses, and error of every invalid address
+func validResults(results []Results) ([]Results, []error) {
+	valid := make([]Results, 0, len(results))
+	var errs []error
+	for i, r := range results {
+		if err := r.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("result %d: %w", i, err))
+			continue
+		}
+		valid = append(valid, r)
+	}
+
+	return valid, errs
+}
+
+// validateAddress check that address is in CIDR notation of the family,
+// and that DNS name is FQDN
+func validateAddress(family int8, address, dnsName string) error {
+	if address == "" {
+		return errors.New("missing address")
+	}
+	if _, _, err := net.ParseCIDR(address); err != nil {
+		return fmt.Errorf("address %q isn't in CIDR notation", address)
+	}
+
+	switch family {
+	case 0:
+		return fmt.Errorf("missing family of %s", address)
+	case 4, 6:
+		if addressFamily(address) != family {
+			return fmt.Errorf("address %s isn't IPv%d", address, family)
+		}
+	default:
+		return fmt.Errorf("invalid family %d of %s", family, address)
+	}
+
+	if dnsName == "" {
+		return nil
+	}
+	if _, ok := dns.IsDomainName(dnsName); !ok || !dnsNameRegexp.MatchString(dnsName) {
+		return fmt.Errorf("dns_name %q of %s isn't valid FQDN", dnsName, address)
+	}
+
+	return nil
+}
@@ -1,38 +1,186 @@
 package nautobot
 
 import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"fmt"
+	"net"
 )
 
+// SignatureHeader is HTTP header used by nautobot to sign webhook body
+const SignatureHeader = "X-Hook-Signature"
+
 type Family struct {
 	Value int8 `json:"value"`
 }
 
+// UnmarshalJSON accept family as object with value, or as plain number used in snapshots
+func (f *Family) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &f.Value); err == nil {
+		return nil
+	}
+
+	type family Family
+	return json.Unmarshal(b, (*family)(f))
+}
+
 type Status struct {
 	Value string `json:"value"`
 }
+
+// UnmarshalJSON accept status as object with value, slug or name, or as plain string used in snapshots
+func (s *Status) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &s.Value); err == nil {
+		return nil
+	}
+
+	var st struct {
+		Value string `json:"value"`
+		Slug  string `json:"slug"`
+		Name  string `json:"name"`
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return err
+	}
+	for _, v := range []string{st.Value, st.Slug, st.Name} {
+		if v != "" {
+			s.Value = v
+			break
+		}
+	}
+	return nil
+}
+
 type Data struct {
-	Family   Family `json:"family"`
-	Address  string `json:"address"`
-	Status   Status `json:"status"`
-	Dns_name string `json:"dns_name"`
+	Family        Family                 `json:"family"`
+	Address       string                 `json:"address"`
+	Status        Status                 `json:"status"`
+	Dns_name      string                 `json:"dns_name"`
+	Tags          Tags                   `json:"tags,omitempty"`
+	Custom_fields map[string]interface{} `json:"custom_fields,omitempty"`
+	Parent        *Ref                   `json:"parent,omitempty"`
+	Vrf           *Ref                   `json:"vrf,omitempty"`
+	Tenant        *Ref                   `json:"tenant,omitempty"`
+	Role          *Ref                   `json:"role,omitempty"`
+}
+
+// Tag is nautobot tag assigned to IP address
+type Tag struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	Slug string `json:"slug,omitempty"`
+}
+
+// UnmarshalJSON accept tag as object, or as plain name used in snapshots
+func (t *Tag) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &t.Name); err == nil {
+		return nil
+	}
+
+	type tag Tag
+	return json.Unmarshal(b, (*tag)(t))
+}
+
+// Tags are all tags of IP address
+type Tags []Tag
+
+// Names returns names of the tags
+func (t Tags) Names() []string {
+	names := make([]string, 0, len(t))
+	for _, tag := range t {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// Snapshots are IP address before the change, state after
+// the change is taken from data of the webhook
+type Snapshots struct {
+	Prechange *Data `json:"prechange"`
 }
 
+// ipAddressEvents are webhook events with IP address data
+var ipAddressEvents = map[string]bool{"created": true, "updated": true, "deleted": true}
+
 // IPaddress is structure for pars webhook intput data
 type IPaddress struct {
-	Event string `json:"event"`
-	Data  Data   `json:"data"`
+	Event     string    `json:"event"`
+	Model     string    `json:"model,omitempty"`
+	Data      Data      `json:"data"`
+	Snapshots Snapshots `json:"snapshots,omitempty"`
 }
 
-// NewIPaddress Unmarshal input byte to json struct
-func NewIPaddress(payload []byte) *IPaddress {
+// NewIPaddress Unmarshal input byte to json struct,
+// data of IP address events are validated
+func NewIPaddress(payload []byte) (*IPaddress, error) {
 	var ip_add IPaddress
 
 	err := json.Unmarshal(payload, &ip_add)
 	if err != nil {
-		log.Println(err)
+		return nil, err
+	}
+	if ip_add.Event == "" {
+		return nil, fmt.Errorf("%w: missing event", ErrInvalidData)
+	}
+
+	// Snapshots may be serialized without family
+	for _, d := range []*Data{&ip_add.Data, ip_add.Snapshots.Prechange} {
+		if d != nil && d.Family.Value == 0 {
+			d.Family.Value = addressFamily(d.Address)
+		}
+	}
+
+	// Other models and events are rejected by the caller
+	if (ip_add.Model != "" && ip_add.Model != "ipaddress") || !ipAddressEvents[ip_add.Event] {
+		return &ip_add, nil
+	}
+
+	if err := ip_add.Data.Validate(); err != nil {
+		return nil, err
+	}
+	if d := ip_add.Snapshots.Prechange; d != nil {
+		if err := d.Validate(); err != nil {
+			return nil, fmt.Errorf("snapshot: %w", err)
+		}
+	}
+
+	return &ip_add, nil
+}
+
+// VerifySignature check nautobot HMAC-SHA512 signature of the payload
+// comparison is done in constant time
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	if signature == "" {
+		return false
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write(payload)
+
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// addressFamily returns family of the address with or without CIDRMask,
+// 0 is returned for invalid address
+func addressFamily(address string) int8 {
+	ip, _, err := net.ParseCIDR(address)
+	if err != nil {
+		ip = net.ParseIP(address)
 	}
 
-	return &ip_add
+	switch {
+	case ip == nil:
+		return 0
+	case ip.To4() != nil:
+		return 4
+	default:
+		return 6
+	}
 }
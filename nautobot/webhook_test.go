@@ -1,7 +1,11 @@
 package nautobot
 
 import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
 	"reflect"
 	"testing"
@@ -30,7 +34,10 @@ func TestNewIPaddress(t *testing.T) {
 
 	// Marshal Testing data,
 	// Test Unmarshal NewIPaddress function
-	exp := NewIPaddress(CreateByteIPaddressArray(ip_add))
+	exp, err := NewIPaddress(CreateByteIPaddressArray(ip_add))
+	if err != nil {
+		t.Fatal("Unable unmarshal IPAddress struct: ", err)
+	}
 
 	// Compare testing structure
 	if reflect.DeepEqual(ip_add, exp) {
@@ -40,3 +47,151 @@ func TestNewIPaddress(t *testing.T) {
 		t.Fatal("Unable unmarshal IPAddress struct. Get: ", exp)
 	}
 }
+
+// TestNewIPaddressMalformed func to test NewIPaddress with broken payload
+func TestNewIPaddressMalformed(t *testing.T) {
+	if _, err := NewIPaddress([]byte(`{"event": "created", "data": `)); err == nil {
+		t.Fatal("Expected error for malformed payload")
+	}
+}
+
+// TestNewIPaddressValidation func to test validation of webhook data
+func TestNewIPaddressValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{name: "Valid", payload: `{"event": "created", "data": {"family": {"value": 4}, "address": "10.0.0.1/24", "dns_name": "a.test"}}`},
+		{name: "Valid IPv6 without family", payload: `{"event": "deleted", "data": {"address": "2001:db8::1/64", "dns_name": "a.test."}}`},
+		{name: "Valid without name", payload: `{"event": "updated", "data": {"family": {"value": 4}, "address": "10.0.0.1/24", "dns_name": ""}}`},
+		{name: "Other model isn't validated", payload: `{"event": "created", "model": "device", "data": {}}`},
+		{name: "Missing event", payload: `{"data": {"family": {"value": 4}, "address": "10.0.0.1/24", "dns_name": "a.test"}}`, wantErr: true},
+		{name: "Missing address", payload: `{"event": "created", "data": {"family": {"value": 4}, "dns_name": "a.test"}}`, wantErr: true},
+		{name: "Address without mask", payload: `{"event": "created", "data": {"family": {"value": 4}, "address": "10.0.0.1", "dns_name": "a.test"}}`, wantErr: true},
+		{name: "Invalid family", payload: `{"event": "created", "data": {"family": {"value": 5}, "address": "10.0.0.1/24", "dns_name": "a.test"}}`, wantErr: true},
+		{name: "Family mismatch", payload: `{"event": "created", "data": {"family": {"value": 6}, "address": "10.0.0.1/24", "dns_name": "a.test"}}`, wantErr: true},
+		{name: "Invalid dns_name", payload: `{"event": "created", "data": {"family": {"value": 4}, "address": "10.0.0.1/24", "dns_name": "a b.test"}}`, wantErr: true},
+		{name: "Empty label", payload: `{"event": "created", "data": {"family": {"value": 4}, "address": "10.0.0.1/24", "dns_name": "a..test"}}`, wantErr: true},
+		{name: "Invalid snapshot", payload: `{"event": "updated", "data": {"family": {"value": 4}, "address": "10.0.0.1/24", "dns_name": "a.test"},
+			"snapshots": {"prechange": {"address": "10.0.0.300/24", "dns_name": "a.test"}}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := NewIPaddress([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewIPaddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && (ip != nil || !errors.Is(err, ErrInvalidData)) {
+				t.Errorf("Expected ErrInvalidData without data, got %v, %v", ip, err)
+			}
+		})
+	}
+}
+
+// TestNewAPIaddress func to test parsing and validation of nautobot API page
+func TestNewAPIaddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    int
+		invalid int
+		wantErr bool
+	}{
+		{name: "Valid", payload: `{"count": 2, "results": [{"family": {"value": 4}, "address": "10.0.0.1/24", "dns_name": "a.test"},
+			{"family": {"value": 6}, "address": "2001:db8::1/64", "dns_name": ""}]}`, want: 2},
+		{name: "Empty", payload: `{"count": 0, "results": []}`},
+		{name: "Malformed", payload: `<html>Login</html>`, wantErr: true},
+		{name: "Missing results", payload: `{"detail": "Invalid token."}`, wantErr: true},
+		{name: "Invalid result is skipped", payload: `{"count": 2, "results": [{"family": {"value": 4}, "address": "10.0.0.1/24", "dns_name": "a.test"},
+			{"family": {"value": 4}, "address": "2001:db8::1/64", "dns_name": "b.test"}]}`, want: 1, invalid: 1},
+		{name: "Family of nautobot 2.x", payload: `{"count": 2, "results": [{"ip_version": 4, "address": "10.0.0.1/24", "dns_name": "a.test"},
+			{"ip_version": 6, "address": "2001:db8::1/64", "dns_name": "b.test"}]}`, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := NewAPIaddress([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAPIaddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (ip.Event != "created" || len(ip.Results) != tt.want || len(ip.Invalid) != tt.invalid) {
+				t.Errorf("Expected %d results, got %+v", tt.want, ip)
+			}
+		})
+	}
+}
+
+// TestVerifySignature func to test VerifySignature
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"event":"created"}`)
+
+	mac := hmac.New(sha512.New, []byte("secret"))
+	mac.Write(payload)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		secret    string
+		payload   []byte
+		signature string
+		want      bool
+	}{
+		{name: "Valid signature", secret: "secret", payload: payload, signature: signature, want: true},
+		{name: "Wrong secret", secret: "other", payload: payload, signature: signature, want: false},
+		{name: "Changed payload", secret: "secret", payload: []byte(`{"event":"deleted"}`), signature: signature, want: false},
+		{name: "Missing signature", secret: "secret", payload: payload, signature: "", want: false},
+		{name: "Malformed signature", secret: "secret", payload: payload, signature: "not-hex", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifySignature(tt.secret, tt.payload, tt.signature); got != tt.want {
+				t.Errorf("VerifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNewIPaddressCustomFields func to test parsing of tags and custom fields
+func TestNewIPaddressCustomFields(t *testing.T) {
+	payload := []byte(`{"event": "created", "data": {"address": "10.0.0.1/24", "dns_name": "a.test", "tags": [{"name": "cname:www.test", "slug": "cname-www-test"}], "custom_fields": {"dns_aliases": "www.test", "dns_mx": null}}}`)
+
+	ip, err := NewIPaddress(payload)
+	if err != nil {
+		t.Fatal("Unable unmarshal IPAddress struct: ", err)
+	}
+	if !reflect.DeepEqual(ip.Data.Tags.Names(), []string{"cname:www.test"}) {
+		t.Errorf("Unexpected tags, got %v", ip.Data.Tags)
+	}
+	if ip.Data.Custom_fields["dns_aliases"] != "www.test" {
+		t.Errorf("Unexpected custom fields, got %v", ip.Data.Custom_fields)
+	}
+}
+
+// TestNewIPaddressSnapshots func to test parsing of prechange snapshot, postchange is ignored
+func TestNewIPaddressSnapshots(t *testing.T) {
+	payload := []byte(`{"event": "updated", "model": "ipaddress",
+		"data": {"family": {"value": 4, "label": "IPv4"}, "address": "10.0.0.2/24", "status": {"value": "active", "label": "Active"}, "dns_name": "new.test"},
+		"snapshots": {
+			"prechange": {"address": "2001:db8::1/64", "status": "deprecated", "dns_name": "old.test", "tags": ["cname:www.test"]},
+			"postchange": {"family": 4, "address": "10.0.0.2", "status": {"slug": "active"}, "dns_name": "new.test"}
+		}}`)
+
+	ip, err := NewIPaddress(payload)
+	if err != nil {
+		t.Fatal("Unable unmarshal IPAddress struct: ", err)
+	}
+
+	pre := ip.Snapshots.Prechange
+	if pre == nil {
+		t.Fatalf("Expected prechange snapshot, got %+v", ip.Snapshots)
+	}
+	if pre.Family.Value != 6 || pre.Status.Value != "deprecated" || pre.Dns_name != "old.test" || pre.Tags.Names()[0] != "cname:www.test" {
+		t.Errorf("Unexpected prechange snapshot, got %+v", pre)
+	}
+	if ip.Data.Family.Value != 4 || ip.Data.Status.Value != "active" {
+		t.Errorf("Unexpected data, got %+v", ip.Data)
+	}
+}
@@ -2,9 +2,13 @@ package nautobotor
 
 import (
 	"context"
-	"io/ioutil"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
@@ -18,14 +22,27 @@ import (
 
 // Nautobotor is an nautobotor structure
 type Nautobotor struct {
-	WebAddress  string
-	NautobotURL string
-	Token       string
-	NS          map[string]string
-	RM          *ramrecords.RamRecord
-	ln          net.Listener
-	mux         *http.ServeMux
-	Next        plugin.Handler
+	WebAddress    string
+	NautobotURL   string
+	GraphQLURL    string // Nautobot GraphQL API, used only with GraphQLQuery
+	GraphQLQuery  string // Query used to load IP addresses instead of REST API
+	Token         string
+	WebhookSecret string
+	ExportToken   string       // Bearer token of zone export, export is disabled without it
+	ExportAllow   []*net.IPNet // Networks allowed to export zones, any when empty
+	Resync        time.Duration
+	Statuses      map[string]bool // Nautobot statuses of published addresses
+	Filter        nautobot.Filter // Scope of published addresses
+	RM            *ramrecords.RamRecord
+	ln            net.Listener
+	server        *http.Server
+	stop          chan struct{}
+	notifier      *notifier
+	persister     *persister
+	status        *syncStatus
+	client        *nautobot.Client
+	mux           *http.ServeMux
+	Next          plugin.Handler
 }
 
 // Define log to be a logger with the plugin name in it. This way we can just use log.Info and
@@ -37,7 +54,10 @@ var log = clog.NewWithPlugin("nautobotor")
 func (n Nautobotor) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
 	state := request.Request{W: w, Req: r}
 	qname := state.Name()
-	zone := plugin.Zones(n.RM.Zones).Matches(qname)
+
+	// Snapshot can't be changed by webhooks while the query is handled
+	snap := n.RM.Snapshot()
+	zone := plugin.Zones(snap.Zones).Matches(qname)
 
 	if zone == "" {
 		// if state.QType() != dns.TypePTR {
@@ -48,13 +68,19 @@ func (n Nautobotor) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.M
 
 	// New we should have some data for this zone, as we just have a list of RR, iterate through them, find the qname
 	// and see if the qtype exists. If so reply, if not do the normal DNS thing and return either A or AAAA.
+	// Export metric with the server label set to the current server handling the request.
+	server := metrics.WithServer(ctx)
+	requestCount.WithLabelValues(server).Inc()
+	queryCount.WithLabelValues(server, zone).Inc()
+
 	m := new(dns.Msg)
 	m.SetReply(r)
 	m.Authoritative = true
 
 	nxdomain := true
 	var soa dns.RR
-	for _, r := range n.RM.M[zone] {
+	var target string
+	for _, r := range snap.M[zone] {
 		if r.Header().Rrtype == dns.TypeSOA && soa == nil {
 			soa = r
 		}
@@ -62,13 +88,22 @@ func (n Nautobotor) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.M
 			nxdomain = false
 			if r.Header().Rrtype == state.QType() {
 				m.Answer = append(m.Answer, r)
+			} else if cname, ok := r.(*dns.CNAME); ok {
+				m.Answer = append(m.Answer, r)
+				target = cname.Target
 			}
 		}
 	}
 
+	// Alias points to the address served by the plugin
+	if target != "" {
+		m.Answer = append(m.Answer, lookup(snap, target, state.QType())...)
+	}
+
 	// handle nxdomain, NODATA and normal response here.
 	if nxdomain {
 		m.Rcode = dns.RcodeNameError
+		nxdomainCount.WithLabelValues(server, zone).Inc()
 		if soa != nil {
 			m.Ns = []dns.RR{soa}
 		}
@@ -80,14 +115,12 @@ func (n Nautobotor) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.M
 	}
 
 	if len(m.Answer) == 0 {
+		nodataCount.WithLabelValues(server, zone).Inc()
 		if soa != nil {
 			m.Ns = []dns.RR{soa}
 		}
 	}
 
-	// Export metric with the server label set to the current server handling the request.
-	requestCount.WithLabelValues(metrics.WithServer(ctx)).Inc()
-
 	err := w.WriteMsg(m)
 	if err != nil {
 		log.Error(err)
@@ -96,40 +129,178 @@ func (n Nautobotor) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.M
 
 }
 
+// lookup returns records of the name and type from the snapshot
+func lookup(snap *ramrecords.Snapshot, name string, qtype uint16) []dns.RR {
+	var rrs []dns.RR
+	for _, r := range snap.M[plugin.Zones(snap.Zones).Matches(name)] {
+		if r.Header().Name == name && r.Header().Rrtype == qtype {
+			rrs = append(rrs, r)
+		}
+	}
+	return rrs
+}
+
 // getApiData send get request to nautobot
-// return data
+// follows the pagination links until every page is loaded
 func (n *Nautobotor) getApiData() error {
+	start := time.Now()
+	defer func() { syncDuration.Observe(time.Since(start).Seconds()) }()
 
-	req, err := http.NewRequest("GET", n.NautobotURL, nil)
+	ip, err := n.fetchAPIData()
 	if err != nil {
-		log.Error(err)
+		n.status.failed(err)
 		return err
 	}
-	req.Header.Set("Authorization", "Token "+n.Token)
-	client := &http.Client{}
-	resp, err := client.Do(req)
+
+	// Unmarshal data to strcut
+	log.Debug(ip)
+	err = n.handleAPIData(ip)
 	if err != nil {
-		log.Errorf("Error on response err=%s\n", err)
+		log.Errorf("error handling DNS data: err=%s\n", err)
+		n.status.failed(err)
 		return err
 	}
-	defer resp.Body.Close()
+	n.status.synced()
+	lastSync.SetToCurrentTime()
+
+	log.Infof("Loaded %d IP addresses from nautobot", len(ip.Results))
+
+	return nil
+
+}
+
+// errIncompleteData is returned when some pages of nautobot API weren't loaded,
+// partial data must not drive removal of the addresses
+var errIncompleteData = errors.New("incomplete nautobot data")
+
+// fetchAPIData walks over all pages of the nautobot API
+// return all results merged into single structure
+func (n *Nautobotor) fetchAPIData() (*nautobot.APIIPaddress, error) {
+	// GraphQL returns all addresses in single round trip
+	if n.GraphQLQuery != "" {
+		return n.getGraphQLData()
+	}
 
-	payload, err := ioutil.ReadAll(resp.Body)
+	// Filter is sent with the first page, nautobot keeps it in the next links
+	first, err := n.Filter.Apply(n.NautobotURL)
 	if err != nil {
-		log.Errorf("Error while reading the response bytes err=%s\n", err)
-		return err
+		return nil, err
+	}
+	if first, err = withDepth(first); err != nil {
+		return nil, err
 	}
 
-	// Unmarshal data to strcut
-	log.Debug(nautobot.NewAPIaddress(payload))
-	err = n.handleAPIData(nautobot.NewAPIaddress(payload))
+	all := &nautobot.APIIPaddress{Event: "created"}
+	seen := make(map[string]bool)
+	skipped := 0
+
+	for next := first; next != ""; {
+		// Protect against pagination loop
+		if seen[next] {
+			return nil, fmt.Errorf("%w: pagination loop on page %s", errIncompleteData, next)
+		}
+		seen[next] = true
+
+		page, err := n.getApiPage(next)
+		if err != nil {
+			return nil, err
+		}
+
+		if all.Results == nil {
+			all.Count = page.Count
+			all.Results = make([]nautobot.Results, 0, page.Count)
+		}
+		all.Results = append(all.Results, page.Results...)
+		skipped += len(page.Invalid)
+
+		if len(page.Results)+len(page.Invalid) == 0 || len(all.Results)+skipped >= all.Count {
+			break
+		}
+		next = page.Next
+	}
+
+	loaded := len(all.Results) + skipped
+	if loaded < all.Count {
+		return nil, fmt.Errorf("%w: nautobot reported %d IP addresses, but %d were loaded", errIncompleteData, all.Count, loaded)
+	}
+	if loaded > all.Count {
+		log.Warningf("Nautobot reported %d IP addresses, but %d were loaded", all.Count, loaded)
+	}
+
+	return all, nil
+}
+
+// withDepth request nested objects of nautobot 2.x REST API with their data,
+// status is returned only as reference at depth 0, unless depth is set in the URL
+func withDepth(apiURL string) (string, error) {
+	u, err := url.Parse(apiURL)
 	if err != nil {
-		log.Errorf("error handling DNS data: err=%s\n", err)
-		return err
+		return "", err
+	}
+	q := u.Query()
+	if q.Get("depth") != "" {
+		return apiURL, nil
 	}
+	q.Set("depth", "1")
+	u.RawQuery = q.Encode()
 
-	return nil
+	return u.String(), nil
+}
+
+// getApiPage send get request for single page to nautobot
+// return data
+func (n *Nautobotor) getApiPage(url string) (*nautobot.APIIPaddress, error) {
+	ctx, cancel := n.stopContext()
+	defer cancel()
 
+	payload, err := n.apiClient().Get(ctx, url)
+	if err != nil {
+		log.Errorf("Error on response err=%s\n", err)
+		return nil, err
+	}
+
+	ip, err := nautobot.NewAPIaddress(payload)
+	if err != nil {
+		log.Errorf("Error parsing nautobot API data err=%s\n", err)
+		return nil, err
+	}
+	reportInvalid(ip)
+
+	return ip, nil
+}
+
+// reportInvalid log and count IP addresses skipped because of invalid data
+func reportInvalid(ip *nautobot.APIIPaddress) {
+	for _, err := range ip.Invalid {
+		log.Warningf("Skip IP address loaded from nautobot: err=%s\n", err)
+		invalidAddresses.Inc()
+	}
+}
+
+// apiClient returns client of nautobot API,
+// client with default options is created when it isn't configured
+func (n *Nautobotor) apiClient() *nautobot.Client {
+	if n.client == nil {
+		// Client with default options can't fail
+		n.client, _ = nautobot.NewClient(nautobot.ClientConfig{Token: n.Token, UserAgent: userAgent()})
+	}
+	return n.client
+}
+
+// stopContext returns context canceled when the plugin is stopped,
+// requests to nautobot and their retries are interrupted by it
+func (n *Nautobotor) stopContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if n.stop != nil {
+		go func(stop chan struct{}) {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}(n.stop)
+	}
+	return ctx, cancel
 }
 
 // onStartup handling web request and response
@@ -144,31 +315,21 @@ func (n *Nautobotor) onStartup() error {
 	n.ln = ln
 	n.mux = http.NewServeMux()
 
-	n.mux.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {
-		log.Debug("Start handling webhook data")
-
-		// handleWebhook are used to processed nautobot webhook
-		payload, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			log.Errorf("error reading request body: err=%s\n", err)
-			return
-		}
-		defer r.Body.Close()
-
-		// Unmarshal data to strcut
-		err = n.handleData(nautobot.NewIPaddress(payload))
-		if err != nil {
-			log.Errorf("error handling DNS data: err=%s\n", err)
-		}
-
-	})
+	n.mux.HandleFunc("/webhook", n.handleWebhook)
+	if n.ExportToken != "" {
+		n.mux.HandleFunc("/zones", n.handleZones)
+		n.mux.HandleFunc("/zones/", n.handleZones)
+	}
+	n.mux.HandleFunc("/health", n.handleHealth)
 
-	go func() {
-		err := http.Serve(n.ln, n.mux)
-		if err != nil {
+	n.server = &http.Server{Handler: n.mux}
+	go func(server *http.Server, ln net.Listener) {
+		err := server.Serve(ln)
+		// Server is closed on shutdown
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Errorf("errro initializing web server: err=%s\n", err)
 		}
-	}()
+	}(n.server, n.ln)
 
 	return nil
 }
@@ -183,54 +344,40 @@ func (n *Nautobotor) handleAPIData(ip *nautobot.APIIPaddress) error {
 
 	case "created":
 		log.Debug("Received API data to creat")
-		for _, i := range ip.Results {
-			// 	// Handle Normal zone
-			n.RM.AddZone(i.Dns_name, n.NS)
-			// Handle PTR zones
-			n.RM.AddPTRZone(i.Family.Value, i.Address, i.Dns_name, n.NS)
-			// Handle PTR zones
-			n.RM.AddPTRZone(i.Family.Value, i.Address, i.Dns_name, n.NS)
-
-			// Add record to the zone
-			n.RM.AddRecord(i.Family.Value, i.Address, i.Dns_name)
-		}
+		// Records may be already loaded from snapshot, apply only differences
+		n.reconcile(ip.Results)
 	default:
 		log.Errorf("Unable processed Event: %v", ip.Event)
+		return fmt.Errorf("%w: %q", errUnsupportedEvent, ip.Event)
 	}
 
 	return nil
 }
 
-// handleData are used to handle incoming data structures
-// returning pointers to nautobot DNS records structures
-func (n *Nautobotor) handleData(ip *nautobot.IPaddress) error {
-	log.Debug("Start handling DNS record")
-	log.Debug("Unmarshaled data from webhook to be add to DNS: data=", ip)
+// addAddress create zones if missing and add record to them,
+// name which isn't in any authoritative zone is rejected
+func (n *Nautobotor) addAddress(ipFamily int8, ip, dnsName string) (*ramrecords.Changes, error) {
+	return n.RM.AddAddress(ipFamily, ip, dnsName)
+}
 
-	switch ip.Event {
-	case "created":
-		log.Debug("Received webhook to creat")
-
-		// Handle Normal zone
-		n.RM.AddZone(ip.Data.Dns_name, n.NS)
-		// Handle PTR zones
-		n.RM.AddPTRZone(ip.Data.Family.Value, ip.Data.Address, ip.Data.Dns_name, n.NS)
-
-		// Add record to the zone
-		n.RM.AddRecord(ip.Data.Family.Value, ip.Data.Address, ip.Data.Dns_name)
-	case "deleted":
-		log.Debug("Received webhook to delet")
-		// Remove record from the zone
-		n.RM.RemoveRecord(ip.Data.Family.Value, ip.Data.Address, ip.Data.Dns_name)
-	case "updated":
-		log.Debug("Received webhook to update")
-		// Update record in the zone
-		n.RM.UpdateRecord(ip.Data.Family.Value, ip.Data.Address, ip.Data.Dns_name, n.NS)
-	default:
-		log.Errorf("Unable processed Event: %v", ip.Event)
+// inScope check if webhook data match the filter of the instance
+func (n *Nautobotor) inScope(data nautobot.Data) bool {
+	return n.Filter.MatchData(data)
+}
+
+// published check if address with nautobot status should resolve,
+// address without status isn't published when statuses are configured
+func (n *Nautobotor) published(status string) bool {
+	if len(n.Statuses) == 0 {
+		return true
 	}
+	return n.Statuses[strings.ToLower(status)]
+}
 
-	return nil
+// removeAddress remove record from the zone,
+// custom records are removed with the last address of the name
+func (n *Nautobotor) removeAddress(ipFamily int8, ip, dnsName string) *ramrecords.Changes {
+	return n.RM.RemoveAddress(ipFamily, ip, dnsName)
 }
 
 // Name implements the Handler interface.
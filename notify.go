@@ -0,0 +1,184 @@
+package nautobotor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/rcode"
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+	"github.com/miekg/dns"
+)
+
+// Default notifier settings
+const (
+	notifyDelay   = time.Second // Window used to coalesce zone changes
+	notifyRetries = 5           // Attempts to deliver single notify
+	notifyBackoff = time.Second // First retry delay, doubled on every retry
+	notifyWorkers = 8           // Notifies sent concurrently
+)
+
+// notifier send RFC 1996 NOTIFY messages to secondaries for changed zones
+type notifier struct {
+	to      []string // Secondaries, host:port
+	rm      *ramrecords.RamRecord
+	client  *dns.Client
+	delay   time.Duration
+	retries int
+	backoff time.Duration
+
+	mu      sync.Mutex
+	pending map[string]bool // Zones waiting for notify
+	timer   *time.Timer     // Armed or running flush
+	stop    chan struct{}
+}
+
+// newNotifier returns notifier for secondaries
+func newNotifier(to []string) *notifier {
+	return &notifier{
+		to:      to,
+		client:  new(dns.Client),
+		delay:   notifyDelay,
+		retries: notifyRetries,
+		backoff: notifyBackoff,
+		pending: make(map[string]bool),
+		stop:    make(chan struct{}),
+	}
+}
+
+// start notify secondaries about every change in rm
+func (nt *notifier) start(rm *ramrecords.RamRecord) {
+	nt.rm = rm
+	rm.OnChange(nt.zonesChanged)
+}
+
+// shutdown stop pending notifies and retries
+func (nt *notifier) shutdown() {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	if nt.timer != nil {
+		nt.timer.Stop()
+	}
+	select {
+	case <-nt.stop:
+	default:
+		close(nt.stop)
+	}
+}
+
+// zonesChanged queue zones for notify, burst of changes
+// is coalesced into single notify per zone
+func (nt *notifier) zonesChanged(zones []string) {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	for _, z := range zones {
+		nt.pending[z] = true
+	}
+	nt.arm()
+}
+
+// arm schedule flush of pending zones, unless flush is already
+// scheduled or running or notifier was stopped, must be called with mu held
+func (nt *notifier) arm() {
+	select {
+	case <-nt.stop:
+		return
+	default:
+	}
+	if nt.timer == nil && len(nt.pending) > 0 {
+		nt.timer = time.AfterFunc(nt.delay, nt.flush)
+	}
+}
+
+// flush send notifies for all pending zones by bounded set of workers,
+// zones changed meanwhile are flushed when all notifies are done
+func (nt *notifier) flush() {
+	nt.mu.Lock()
+	pending := nt.pending
+	nt.pending = make(map[string]bool)
+	nt.mu.Unlock()
+
+	jobs := make(chan notifyJob)
+	var wg sync.WaitGroup
+	for i := 0; i < notifyWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := nt.send(j.m, j.to); err != nil {
+					log.Warning(err)
+				}
+			}
+		}()
+	}
+
+	snap := nt.rm.Snapshot()
+	for zone := range pending {
+		var soa dns.RR
+		for _, rr := range snap.M[zone] {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				soa = rr
+				break
+			}
+		}
+
+		m := new(dns.Msg)
+		m.SetNotify(zone)
+		if soa != nil {
+			m.Answer = []dns.RR{soa}
+		}
+
+		for _, to := range nt.to {
+			jobs <- notifyJob{m: m.Copy(), to: to}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+	nt.timer = nil
+	nt.arm()
+}
+
+// notifyJob is notify of single zone to single secondary
+type notifyJob struct {
+	m  *dns.Msg
+	to string
+}
+
+// send deliver notify to secondary, retry with exponential
+// backoff until it is acknowledged
+func (nt *notifier) send(m *dns.Msg, to string) error {
+	zone := m.Question[0].Name
+	backoff := nt.backoff
+
+	var err error
+	for i := 0; i < nt.retries; i++ {
+		if i > 0 {
+			select {
+			case <-nt.stop:
+				return fmt.Errorf("notify for zone %q to %q canceled", zone, to)
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		var ret *dns.Msg
+		ret, _, err = nt.client.Exchange(m, to)
+		if err != nil {
+			continue
+		}
+		if ret.Rcode != dns.RcodeSuccess {
+			err = fmt.Errorf("rcode was %q", rcode.ToString(ret.Rcode))
+			continue
+		}
+
+		log.Debugf("Sent notify for zone %q to %q", zone, to)
+		return nil
+	}
+
+	return fmt.Errorf("notify for zone %q was not accepted by %q: %s", zone, to, err)
+}
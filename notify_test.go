@@ -0,0 +1,120 @@
+package nautobotor
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+	"github.com/miekg/dns"
+)
+
+// secondary is fake secondary server counting received notifies
+type secondary struct {
+	mu       sync.Mutex
+	notifies map[string]int
+	failures int // Number of notifies to refuse before acknowledging
+}
+
+func (s *secondary) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	if r.Opcode != dns.OpcodeNotify {
+		m.Rcode = dns.RcodeRefused
+	} else if s.failures > 0 {
+		s.failures--
+		m.Rcode = dns.RcodeServerFailure
+	} else {
+		s.notifies[r.Question[0].Name]++
+	}
+	w.WriteMsg(m)
+}
+
+func (s *secondary) count(zone string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notifies[zone]
+}
+
+func startSecondary(t *testing.T, failures int) (*secondary, string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable listen error = %s", err)
+	}
+
+	s := &secondary{notifies: make(map[string]int), failures: failures}
+	srv := &dns.Server{PacketConn: pc, Handler: s}
+	go srv.ActivateAndServe()
+
+	return s, pc.LocalAddr().String(), func() { srv.Shutdown() }
+}
+
+func TestNotify(t *testing.T) {
+	s, addr, stop := startSecondary(t, 2)
+	defer stop()
+
+	n := Nautobotor{RM: ramrecords.New()}
+
+	nt := newNotifier([]string{addr})
+	nt.delay = 50 * time.Millisecond
+	nt.backoff = 10 * time.Millisecond
+	nt.start(n.RM)
+	defer nt.shutdown()
+
+	// Burst of webhooks is coalesced into single notify per zone
+	for i := 1; i <= 10; i++ {
+		n.addAddress(4, "10.9.9.1/24", "host.notify.test.")
+		n.removeAddress(4, "10.9.9.1/24", "host.notify.test.")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if s.count("notify.test.") > 0 && s.count("9.9.10.in-addr.arpa.") > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Wait for possible extra notifies
+	time.Sleep(100 * time.Millisecond)
+
+	for _, zone := range []string{"notify.test.", "9.9.10.in-addr.arpa."} {
+		if got := s.count(zone); got != 1 {
+			t.Errorf("Expected 1 notify for zone %s, got %d", zone, got)
+		}
+	}
+}
+
+func TestNotifyNotAcknowledged(t *testing.T) {
+	_, addr, stop := startSecondary(t, 100)
+	defer stop()
+
+	nt := newNotifier([]string{addr})
+	nt.retries = 3
+	nt.backoff = time.Millisecond
+	defer nt.shutdown()
+
+	m := new(dns.Msg)
+	m.SetNotify("example.org.")
+	if err := nt.send(m, addr); err == nil {
+		t.Error("Expected error for not acknowledged notify")
+	}
+}
+
+func TestNotifyAfterShutdown(t *testing.T) {
+	nt := newNotifier([]string{"127.0.0.1:53"})
+	nt.shutdown()
+
+	// Change published during shutdown doesn't schedule notify
+	nt.zonesChanged([]string{"example.org."})
+
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+	if nt.timer != nil {
+		t.Error("Expected no notify scheduled after shutdown")
+	}
+}
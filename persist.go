@@ -0,0 +1,109 @@
+package nautobotor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+)
+
+// persistDelay is window used to coalesce changes before snapshot is written
+const persistDelay = time.Second
+
+// persister keep RamRecord snapshot on the disk, used for warm start
+type persister struct {
+	path  string
+	delay time.Duration
+	rm    *ramrecords.RamRecord
+
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+// newPersister returns persister writing snapshot to path
+func newPersister(path string) *persister {
+	return &persister{
+		path:  path,
+		delay: persistDelay,
+	}
+}
+
+// load read snapshot from the disk into rm
+func (p *persister) load(rm *ramrecords.RamRecord) error {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return rm.Load(f)
+}
+
+// start write snapshot now and after every change in rm
+func (p *persister) start(rm *ramrecords.RamRecord) {
+	p.rm = rm
+	rm.OnChange(p.changed)
+
+	if err := p.save(); err != nil {
+		log.Errorf("Unable write snapshot: err=%s\n", err)
+	}
+}
+
+// shutdown write pending changes
+func (p *persister) shutdown() {
+	p.mu.Lock()
+	pending := p.timer != nil && p.timer.Stop()
+	p.timer = nil
+	p.mu.Unlock()
+
+	if pending {
+		if err := p.save(); err != nil {
+			log.Errorf("Unable write snapshot: err=%s\n", err)
+		}
+	}
+}
+
+// changed schedule snapshot write, burst of changes is written once
+func (p *persister) changed(zones []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.timer == nil {
+		p.timer = time.AfterFunc(p.delay, func() {
+			p.mu.Lock()
+			p.timer = nil
+			p.mu.Unlock()
+
+			if err := p.save(); err != nil {
+				log.Errorf("Unable write snapshot: err=%s\n", err)
+			}
+		})
+	}
+}
+
+// save write snapshot atomically, temporary file is renamed over the old one
+func (p *persister) save() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(p.path), filepath.Base(p.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := p.rm.Save(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	log.Debugf("Written snapshot to %s", p.path)
+	return os.Rename(tmp.Name(), p.path)
+}
@@ -0,0 +1,146 @@
+package nautobotor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jakubjastrabik/nautobotor/nautobot"
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+	"github.com/miekg/dns"
+)
+
+func snapshotStrings(rm *ramrecords.RamRecord) map[string][]string {
+	m := make(map[string][]string)
+	for zone, records := range rm.Snapshot().M {
+		for _, rr := range records {
+			m[zone] = append(m[zone], rr.String())
+		}
+	}
+	return m
+}
+
+func TestPersistRoundTrip(t *testing.T) {
+	n := Nautobotor{RM: ramrecords.New()}
+	n.addAddress(4, "10.10.10.1/24", "a.persist.test.")
+	n.addAddress(6, "2001:db8::10/64", "b.persist.test.")
+
+	p := newPersister(filepath.Join(t.TempDir(), "nautobotor.snapshot"))
+	p.start(n.RM)
+
+	rm := ramrecords.New()
+	if err := p.load(rm); err != nil {
+		t.Fatalf("persister.load() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(n.RM.Snapshot().Zones, rm.Snapshot().Zones) {
+		t.Errorf("Expected zones %v, got %v", n.RM.Snapshot().Zones, rm.Snapshot().Zones)
+	}
+	if !reflect.DeepEqual(snapshotStrings(n.RM), snapshotStrings(rm)) {
+		t.Errorf("Expected records %v, got %v", snapshotStrings(n.RM), snapshotStrings(rm))
+	}
+}
+
+func TestPersistAfterChange(t *testing.T) {
+	n := Nautobotor{RM: ramrecords.New()}
+
+	p := newPersister(filepath.Join(t.TempDir(), "nautobotor.snapshot"))
+	p.delay = 10 * time.Millisecond
+	p.start(n.RM)
+
+	n.addAddress(4, "10.10.10.1/24", "a.persist.test.")
+	p.shutdown()
+
+	rm := ramrecords.New()
+	if err := p.load(rm); err != nil {
+		t.Fatalf("persister.load() error = %v", err)
+	}
+	if len(rm.Addresses()) != 1 {
+		t.Errorf("Expected 1 address in snapshot, got %v", rm.Addresses())
+	}
+}
+
+func TestWarmStart(t *testing.T) {
+	defer func(d time.Duration) { syncRetryInterval = d }(syncRetryInterval)
+	syncRetryInterval = 10 * time.Millisecond
+
+	// Snapshot written before restart
+	path := filepath.Join(t.TempDir(), "nautobotor.snapshot")
+	old := Nautobotor{RM: ramrecords.New()}
+	old.addAddress(4, "10.11.11.1/24", "old.warm.test.")
+	newPersister(path).start(old.RM)
+
+	// Nautobot is down first
+	var up int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&up) == 0 {
+			panic(http.ErrAbortHandler)
+		}
+		json.NewEncoder(w).Encode(nautobot.APIIPaddress{
+			Count: 1,
+			Results: []nautobot.Results{
+				{Family: nautobot.Family{Value: 4}, Address: "10.11.11.2/24", Dns_name: "new.warm.test."},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	n := Nautobotor{
+		NautobotURL: srv.URL,
+		RM:          ramrecords.New(),
+		persister:   newPersister(path),
+		client:      newTestClient(t),
+		stop:        make(chan struct{}),
+		status:      new(syncStatus),
+	}
+	defer n.shutdown()
+
+	if err := n.initialSync(); err != nil {
+		t.Fatalf("Nautobotor.initialSync() error = %v", err)
+	}
+	if !n.Ready() {
+		t.Error("Expected plugin ready after snapshot was loaded")
+	}
+	testDNSQuestion(t, n, "A", "old.warm.test.", "10.11.11.1")
+
+	// Nautobot is back, snapshot is reconciled
+	atomic.StoreInt32(&up, 1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if addrs := n.RM.Addresses(); len(addrs) == 1 && addrs[0].DnsName == "new.warm.test." {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	testDNSQuestion(t, n, "A", "new.warm.test.", "10.11.11.2")
+
+	for _, a := range n.RM.Addresses() {
+		if a.DnsName == dns.Fqdn("old.warm.test") {
+			t.Errorf("Expected stale record to be removed, got %v", a)
+		}
+	}
+}
+
+func TestColdStartWithoutNautobot(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer srv.Close()
+
+	n := Nautobotor{
+		NautobotURL: srv.URL,
+		RM:          ramrecords.New(),
+		persister:   newPersister(filepath.Join(t.TempDir(), "missing.snapshot")),
+		client:      newTestClient(t),
+	}
+
+	if err := n.initialSync(); err == nil {
+		t.Error("Expected error without nautobot and snapshot")
+	}
+}
@@ -0,0 +1,83 @@
+package ramrecords
+
+// Tx changes the zones inside Batch, all changes are published together
+// with a single serial bump, journal entry and change notification
+type Tx struct {
+	re *RamRecord
+}
+
+// Batch run fn in a single update, changes made before fn failed are published too
+func (re *RamRecord) Batch(fn func(tx *Tx) error) (*Changes, error) {
+	var err error
+	changes := re.update(func() { err = fn(&Tx{re: re}) })
+	return changes, err
+}
+
+// AddAddress create zones of the address if missing and add its records,
+// name which isn't in any authoritative zone is rejected
+func (re *RamRecord) AddAddress(ipFamily int8, ip, dnsName string) (*Changes, error) {
+	return re.Batch(func(tx *Tx) error { return tx.AddAddress(ipFamily, ip, dnsName) })
+}
+
+// RemoveAddress remove records of the address,
+// custom records are removed with the last address of the name
+func (re *RamRecord) RemoveAddress(ipFamily int8, ip, dnsName string) *Changes {
+	changes, _ := re.Batch(func(tx *Tx) error {
+		tx.RemoveAddress(ipFamily, ip, dnsName)
+		return nil
+	})
+	return changes
+}
+
+// AddAddress create zones of the address if missing and add its records
+func (tx *Tx) AddAddress(ipFamily int8, ip, dnsName string) error {
+	if _, err := tx.re.ZoneFor(dnsName); err != nil {
+		return err
+	}
+
+	tx.re.addZone(dnsName)
+	tx.re.addPTRZone(ipFamily, ip, dnsName)
+	tx.re.addRecord(ipFamily, ip, dnsName)
+
+	return nil
+}
+
+// RemoveAddress remove records of the address,
+// custom records are removed with the last address of the name
+func (tx *Tx) RemoveAddress(ipFamily int8, ip, dnsName string) {
+	tx.re.removeRecord(ipFamily, ip, dnsName)
+	tx.re.dropAddressData(dnsName, ip)
+}
+
+// UpdateRecord add the address under dnsName, the only other name of the address is renamed
+func (tx *Tx) UpdateRecord(ipFamily int8, ip, dnsName string) error {
+	if _, err := tx.re.ZoneFor(dnsName); err != nil {
+		return err
+	}
+
+	tx.re.updateRecord(ipFamily, ip, dnsName)
+	return nil
+}
+
+// SetAddressData set custom fields and tags of the address, custom records
+// pointing to dnsName are generated from data of all its known addresses
+func (tx *Tx) SetAddressData(dnsName, ip string, data RecordData) error {
+	if len(tx.re.Config.Records) == 0 {
+		return nil
+	}
+	return tx.re.setAddressData(dnsName, ip, data)
+}
+
+// SetNameData replace custom record data of all addresses of dnsName, keyed by IP address,
+// and generate custom records of the name from them
+func (tx *Tx) SetNameData(dnsName string, data map[string]RecordData) error {
+	if len(tx.re.Config.Records) == 0 {
+		return nil
+	}
+	return tx.re.setNameData(dnsName, data)
+}
+
+// Addresses returns A and AAAA records including the changes made by the batch
+func (tx *Tx) Addresses() []Address {
+	return addresses(tx.re.M)
+}
@@ -0,0 +1,137 @@
+package ramrecords
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Default SOA timers, used when they aren't configured
+const (
+	defaultRefresh = 7200
+	defaultRetry   = 3600
+	defaultExpire  = 1209600
+	defaultMinttl  = 3600
+)
+
+// NameServer is name server published in the zones. Name without
+// trailing dot is relative to the zone, IPv4 and IPv6 are used as glue.
+type NameServer struct {
+	Name string
+	IPv4 net.IP
+	IPv6 net.IP
+}
+
+// SOA holds fields used to generate SOA record of the zone.
+// Mname and Rname without trailing dot are relative to the zone.
+type SOA struct {
+	Mname   string
+	Rname   string
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minttl  uint32
+}
+
+// ZoneConfig is name server set and SOA published in the zone
+type ZoneConfig struct {
+	NS  []NameServer
+	SOA SOA
+}
+
+// Config holds default zone config and per-zone overrides
+type Config struct {
+	Default ZoneConfig
+	Zones   map[string]ZoneConfig // Overrides keyed by zone FQDN
+	Journal int                   // Max deltas kept per zone for IXFR, 0 disable journal
+	Serial  string                // Policy used to generate SOA serial
+	Records []RecordSource        // Custom records generated from nautobot data
+
+	// Authoritative are forward zones of the DNS names, the name belongs to the longest
+	// matching zone. Without zones the name belongs to the zone without the first label.
+	Authoritative []string
+
+	// Reverse are prefixes of reverse zones, the address belongs to the zone of the longest
+	// matching prefix. Without prefix the address belongs to /24 or /32 IPv6 zone.
+	Reverse []*net.IPNet
+}
+
+// zone returns config of the zone, with per-zone overrides applied
+func (c Config) zone(zone string) ZoneConfig {
+	zc := c.Default
+
+	if o, ok := c.Zones[strings.ToLower(dns.Fqdn(zone))]; ok {
+		if len(o.NS) > 0 {
+			zc.NS = o.NS
+		}
+		if o.SOA.Mname != "" {
+			zc.SOA.Mname = o.SOA.Mname
+		}
+		if o.SOA.Rname != "" {
+			zc.SOA.Rname = o.SOA.Rname
+		}
+		if o.SOA.Refresh != 0 {
+			zc.SOA.Refresh = o.SOA.Refresh
+		}
+		if o.SOA.Retry != 0 {
+			zc.SOA.Retry = o.SOA.Retry
+		}
+		if o.SOA.Expire != 0 {
+			zc.SOA.Expire = o.SOA.Expire
+		}
+		if o.SOA.Minttl != 0 {
+			zc.SOA.Minttl = o.SOA.Minttl
+		}
+	}
+
+	// Fill missing values with defaults
+	if zc.SOA.Mname == "" {
+		zc.SOA.Mname = "ns"
+		if len(zc.NS) > 0 {
+			zc.SOA.Mname = zc.NS[0].Name
+		}
+	}
+	if zc.SOA.Rname == "" {
+		zc.SOA.Rname = "hostmaster"
+	}
+	if zc.SOA.Refresh == 0 {
+		zc.SOA.Refresh = defaultRefresh
+	}
+	if zc.SOA.Retry == 0 {
+		zc.SOA.Retry = defaultRetry
+	}
+	if zc.SOA.Expire == 0 {
+		zc.SOA.Expire = defaultExpire
+	}
+	if zc.SOA.Minttl == 0 {
+		zc.SOA.Minttl = defaultMinttl
+	}
+
+	return zc
+}
+
+// qualify make name FQDN, relative names are appended to origin
+func qualify(name, origin string) string {
+	if dns.IsFqdn(name) {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name + "." + dns.Fqdn(origin))
+}
+
+// zoneFor returns zone of the DNS name, empty when the name
+// isn't in any authoritative zone
+func (c Config) zoneFor(dnsName string) string {
+	name := strings.ToLower(dns.Fqdn(dnsName))
+	if len(c.Authoritative) == 0 {
+		return parseZone(name)
+	}
+
+	zone := ""
+	for _, z := range c.Authoritative {
+		if dns.IsSubDomain(z, name) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	return zone
+}
@@ -0,0 +1,362 @@
+package ramrecords
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// customTTL is TTL of generated records, same as TTL of records parsed without TTL
+const customTTL = 3600
+
+// RecordSource maps nautobot custom field or tags of IP address
+// to records of the Type generated for the address.
+//
+// Values are names and data of the records pointing to the address DNS name:
+//
+//	CNAME: ALIAS
+//	MX:    DOMAIN PREFERENCE
+//	SRV:   _SERVICE._PROTO.DOMAIN PRIORITY WEIGHT PORT
+//	TXT:   TEXT
+//
+// Names are absolute, as the DNS name of the address in nautobot.
+type RecordSource struct {
+	Type        uint16 // dns.TypeCNAME, dns.TypeMX, dns.TypeSRV or dns.TypeTXT
+	CustomField string // Custom field with the values, string with comma separated values or list
+	TagPrefix   string // Tags starting with the prefix, rest of the tag name is the value
+}
+
+// RecordData are custom fields and tag names of single IP address
+type RecordData struct {
+	CustomFields map[string]interface{}
+	Tags         []string
+}
+
+// RecordError is returned when some of the custom records are invalid,
+// valid records are applied anyway
+type RecordError struct {
+	Errors []string
+}
+
+func (e *RecordError) Error() string {
+	return "invalid records: " + strings.Join(e.Errors, "; ")
+}
+
+// setCustomRecords replace records generated from custom fields and tags pointing to dnsName
+// by the records generated from data of all IP addresses of dnsName
+func (re *RamRecord) setCustomRecords(dnsName string, data []RecordData) error {
+	host := strings.ToLower(dns.Fqdn(dnsName))
+
+	var errs []string
+	want := make(map[string][]dns.RR)
+	for _, d := range data {
+		rrs, e := re.Config.customRecords(host, d)
+		errs = append(errs, e...)
+
+		for _, rr := range rrs {
+			zone := re.zoneOf(rr.Header().Name)
+			if zone == "" {
+				errs = append(errs, fmt.Sprintf("%s isn't in any served zone", rr.Header().Name))
+				continue
+			}
+			if rr.Header().Rrtype == dns.TypeCNAME && re.hasOtherData(zone, rr) {
+				errs = append(errs, fmt.Sprintf("CNAME %s conflicts with other records", rr.Header().Name))
+				continue
+			}
+			if !containsRR(want[zone], rr) {
+				want[zone] = append(want[zone], rr)
+			}
+		}
+	}
+
+	// Remove stale records
+	for zone, records := range re.M {
+		for _, rr := range records {
+			if pointsTo(rr, host) && !containsRR(want[zone], rr) {
+				re.removeRR(zone, rr)
+			}
+		}
+	}
+
+	// Add missing records
+	for zone, rrs := range want {
+		for _, rr := range rrs {
+			re.addRR(zone, rr)
+		}
+	}
+
+	if len(errs) > 0 {
+		return &RecordError{Errors: errs}
+	}
+	return nil
+}
+
+// SetNameData replace custom record data of all addresses of dnsName, keyed by IP address,
+// and generate custom records of the name from them
+func (re *RamRecord) SetNameData(dnsName string, data map[string]RecordData) (*Changes, error) {
+	return re.Batch(func(tx *Tx) error { return tx.SetNameData(dnsName, data) })
+}
+
+func (re *RamRecord) setNameData(dnsName string, data map[string]RecordData) error {
+	host := strings.ToLower(dns.Fqdn(dnsName))
+	re.data[host] = make(map[string]RecordData, len(data))
+	for ip, d := range data {
+		re.data[host][cutCIDRMask(ip)] = d
+	}
+	return re.setCustomRecords(host, re.nameData(host))
+}
+
+// setAddressData set custom record data of single address of dnsName,
+// custom records are generated from data of all known addresses of the name
+func (re *RamRecord) setAddressData(dnsName, ip string, data RecordData) error {
+	host := strings.ToLower(dns.Fqdn(dnsName))
+	if re.data[host] == nil {
+		re.data[host] = make(map[string]RecordData)
+	}
+	re.data[host][cutCIDRMask(ip)] = data
+
+	return re.setCustomRecords(host, re.nameData(host))
+}
+
+// dropAddressData remove custom record data of the address and generate custom
+// records of the name from data of the other addresses
+func (re *RamRecord) dropAddressData(dnsName, ip string) {
+	if len(re.Config.Records) == 0 {
+		return
+	}
+
+	host := strings.ToLower(dns.Fqdn(dnsName))
+	delete(re.data[host], cutCIDRMask(ip))
+	if len(re.data[host]) == 0 {
+		delete(re.data, host)
+		re.releaseCustomRecords(host)
+		return
+	}
+
+	// Errors were reported when the data were set
+	_ = re.setCustomRecords(host, re.nameData(host))
+}
+
+// nameData returns custom record data of all addresses of the name, ordered by address
+func (re *RamRecord) nameData(host string) []RecordData {
+	ips := make([]string, 0, len(re.data[host]))
+	for ip := range re.data[host] {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	data := make([]RecordData, 0, len(ips))
+	for _, ip := range ips {
+		data = append(data, re.data[host][ip])
+	}
+	return data
+}
+
+// customRecords generate records pointing to host from custom fields and tags
+func (c Config) customRecords(host string, d RecordData) ([]dns.RR, []string) {
+	var rrs []dns.RR
+	var errs []string
+
+	for _, src := range c.Records {
+		var values []string
+		if src.CustomField != "" {
+			v, err := fieldValues(d.CustomFields[src.CustomField], src.Type)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("custom field %s: %s", src.CustomField, err))
+			}
+			values = append(values, v...)
+		}
+		if src.TagPrefix != "" {
+			for _, tag := range d.Tags {
+				if strings.HasPrefix(tag, src.TagPrefix) {
+					values = append(values, tag[len(src.TagPrefix):])
+				}
+			}
+		}
+
+		for _, v := range values {
+			rr, err := customRecord(src.Type, host, v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s %q: %s", dns.TypeToString[src.Type], v, err))
+				continue
+			}
+			rrs = append(rrs, rr)
+		}
+	}
+
+	return rrs, errs
+}
+
+// fieldValues returns values of custom field, string is split by commas,
+// except of TXT, where commas are part of the text
+func fieldValues(v interface{}, t uint16) ([]string, error) {
+	var values []string
+
+	switch v := v.(type) {
+	case nil:
+	case string:
+		if t == dns.TypeTXT {
+			values = []string{v}
+			break
+		}
+		values = strings.Split(v, ",")
+	case []interface{}:
+		for _, i := range v {
+			s, ok := i.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported value %v", i)
+			}
+			values = append(values, s)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported value %v", v)
+	}
+
+	// Drop empty values
+	out := values[:0]
+	for _, s := range values {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// customRecord parse single value to record pointing to host
+func customRecord(t uint16, host, value string) (dns.RR, error) {
+	fields := strings.Fields(value)
+	hdr := func(name string) dns.RR_Header {
+		return dns.RR_Header{Name: strings.ToLower(dns.Fqdn(name)), Rrtype: t, Class: dns.ClassINET, Ttl: customTTL}
+	}
+
+	switch t {
+	case dns.TypeCNAME:
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("expected ALIAS")
+		}
+		if err := validName(fields[0]); err != nil {
+			return nil, err
+		}
+		rr := &dns.CNAME{Hdr: hdr(fields[0]), Target: host}
+		if rr.Hdr.Name == host {
+			return nil, fmt.Errorf("alias points to itself")
+		}
+		return rr, nil
+
+	case dns.TypeMX:
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("expected DOMAIN PREFERENCE")
+		}
+		if err := validName(fields[0]); err != nil {
+			return nil, err
+		}
+		pref, err := strconv.ParseUint(fields[1], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preference %s", fields[1])
+		}
+		return &dns.MX{Hdr: hdr(fields[0]), Preference: uint16(pref), Mx: host}, nil
+
+	case dns.TypeSRV:
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("expected _SERVICE._PROTO.DOMAIN PRIORITY WEIGHT PORT")
+		}
+		labels := dns.SplitDomainName(fields[0])
+		if len(labels) < 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+			return nil, fmt.Errorf("invalid service name %s", fields[0])
+		}
+		if err := validName(fields[0]); err != nil {
+			return nil, err
+		}
+		var n [3]uint16
+		for i, f := range fields[1:] {
+			v, err := strconv.ParseUint(f, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s", f)
+			}
+			n[i] = uint16(v)
+		}
+		return &dns.SRV{Hdr: hdr(fields[0]), Priority: n[0], Weight: n[1], Port: n[2], Target: host}, nil
+
+	case dns.TypeTXT:
+		// Character strings are limited to 255 bytes
+		var txt []string
+		for len(value) > 255 {
+			txt = append(txt, value[:255])
+			value = value[255:]
+		}
+		return &dns.TXT{Hdr: hdr(host), Txt: append(txt, value)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported record type")
+}
+
+// validName check if name is valid domain name
+func validName(name string) error {
+	if _, ok := dns.IsDomainName(name); !ok {
+		return fmt.Errorf("invalid name %s", name)
+	}
+	return nil
+}
+
+// pointsTo check if rr is custom record generated for host
+func pointsTo(rr dns.RR, host string) bool {
+	switch r := rr.(type) {
+	case *dns.CNAME:
+		return r.Target == host
+	case *dns.MX:
+		return r.Mx == host
+	case *dns.SRV:
+		return r.Target == host
+	case *dns.TXT:
+		return r.Hdr.Name == host
+	}
+	return false
+}
+
+// hasOtherData check if the owner of CNAME has other records in the zone
+func (re *RamRecord) hasOtherData(zone string, cname dns.RR) bool {
+	for _, rr := range re.M[zone] {
+		if rr.Header().Name == cname.Header().Name && !dns.IsDuplicate(rr, cname) {
+			return true
+		}
+	}
+	return false
+}
+
+// zoneOf returns the longest served zone of the name
+func (re *RamRecord) zoneOf(name string) string {
+	zone := ""
+	for _, z := range re.Zones {
+		if dns.IsSubDomain(z, name) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	return zone
+}
+
+// containsRR check if rrs contains duplicate of rr
+func containsRR(rrs []dns.RR, rr dns.RR) bool {
+	for _, r := range rrs {
+		if dns.IsDuplicate(r, rr) {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseCustomRecords remove custom records pointing to dnsName,
+// when no address of dnsName is left in the zones
+func (re *RamRecord) releaseCustomRecords(dnsName string) {
+	host := strings.ToLower(dns.Fqdn(dnsName))
+	for _, a := range addresses(re.M) {
+		if a.DnsName == host {
+			return
+		}
+	}
+
+	// Error can't be returned without data
+	_ = re.setCustomRecords(host, nil)
+}
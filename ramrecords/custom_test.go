@@ -0,0 +1,119 @@
+package ramrecords
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// customConfig generates custom records of all types
+var customConfig = Config{
+	Default: ZoneConfig{NS: []NameServer{{Name: "ns1"}}},
+	Records: []RecordSource{
+		{Type: dns.TypeCNAME, CustomField: "dns_aliases"},
+		{Type: dns.TypeCNAME, TagPrefix: "cname:"},
+		{Type: dns.TypeMX, CustomField: "dns_mx"},
+		{Type: dns.TypeSRV, CustomField: "dns_srv"},
+		{Type: dns.TypeTXT, CustomField: "dns_txt"},
+	},
+}
+
+// customHost is address the custom records point to
+var customHost = testAddress{4, "10.19.19.1/24", "host.custom.test."}
+
+// customStrings returns custom records of all zones in presentation format
+func customStrings(re *RamRecord, host string) []string {
+	var s []string
+	for _, records := range re.Snapshot().M {
+		for _, rr := range records {
+			if pointsTo(rr, host) {
+				s = append(s, strings.Replace(rr.String(), "\t", " ", -1))
+			}
+		}
+	}
+	return s
+}
+
+func TestSetNameData(t *testing.T) {
+	re := newTestRecords(t, customConfig, customHost)
+
+	changes, err := re.SetNameData("host.custom.test", map[string]RecordData{"10.19.19.1": {
+		CustomFields: map[string]interface{}{
+			"dns_aliases": "www.custom.test, ftp.custom.test",
+			"dns_mx":      []interface{}{"custom.test 10"},
+			"dns_srv":     "_ldap._tcp.custom.test 0 5 389",
+			"dns_txt":     "v=spf1 a, -all",
+		},
+		Tags: []string{"cname:git.custom.test", "other"},
+	}})
+	if err != nil {
+		t.Fatalf("SetNameData() error = %v", err)
+	}
+	if len(changes.Added) != 6 || len(changes.Removed) != 0 {
+		t.Errorf("Expected 6 added records, got %+v", changes)
+	}
+
+	want := map[string]bool{
+		"www.custom.test. 3600 IN CNAME host.custom.test.":              true,
+		"ftp.custom.test. 3600 IN CNAME host.custom.test.":              true,
+		"git.custom.test. 3600 IN CNAME host.custom.test.":              true,
+		"custom.test. 3600 IN MX 10 host.custom.test.":                  true,
+		"_ldap._tcp.custom.test. 3600 IN SRV 0 5 389 host.custom.test.": true,
+		"host.custom.test. 3600 IN TXT \"v=spf1 a, -all\"":              true,
+	}
+	got := customStrings(re, "host.custom.test.")
+	if len(got) != len(want) {
+		t.Errorf("Expected %d custom records, got %v", len(want), got)
+	}
+	for _, s := range got {
+		if !want[s] {
+			t.Errorf("Unexpected custom record %q", s)
+		}
+	}
+
+	// Records missing in the new data are removed
+	serial := re.Snapshot().M["custom.test."][0].(*dns.SOA).Serial
+	changes, _ = re.SetNameData("host.custom.test", map[string]RecordData{"10.19.19.1": {
+		CustomFields: map[string]interface{}{"dns_aliases": "www.custom.test"},
+	}})
+	if len(changes.Added) != 0 || len(changes.Removed) != 5 {
+		t.Errorf("Expected 5 removed records, got %+v", changes)
+	}
+	if re.Snapshot().M["custom.test."][0].(*dns.SOA).Serial == serial {
+		t.Error("Expected serial bump after removing records")
+	}
+
+	// Last address of the name release its custom records
+	re.RemoveAddress(4, "10.19.19.1/24", "host.custom.test.")
+	if got := customStrings(re, "host.custom.test."); len(got) != 0 {
+		t.Errorf("Expected no custom records, got %v", got)
+	}
+}
+
+func TestSetNameDataInvalid(t *testing.T) {
+	re := newTestRecords(t, customConfig, customHost)
+
+	changes, err := re.SetNameData("host.custom.test", map[string]RecordData{"10.19.19.1": {
+		CustomFields: map[string]interface{}{
+			"dns_aliases": "www.custom.test, custom.test, www.other.test, host.custom.test",
+			"dns_mx":      "custom.test high",
+			"dns_srv":     "ldap.custom.test 0 5 389",
+			"dns_txt":     float64(42),
+		},
+	}})
+
+	var recErr *RecordError
+	if !errors.As(err, &recErr) {
+		t.Fatalf("Expected RecordError, got %v", err)
+	}
+	if len(recErr.Errors) != 6 {
+		t.Errorf("Expected 6 errors, got %q", recErr.Errors)
+	}
+
+	// Valid records are applied anyway
+	if len(changes.Added) != 1 || changes.Added[0].Header().Name != "www.custom.test." {
+		t.Errorf("Expected only valid alias added, got %+v", changes)
+	}
+}
@@ -1,9 +1,9 @@
 package ramrecords
 
 import (
+	"fmt"
 	"net"
 	"strings"
-	"time"
 
 	"github.com/miekg/dns"
 )
@@ -25,8 +25,7 @@ func (re *RamRecord) newRecord(zone, s string) {
 	log.Debug("handling dns record creation")
 
 	rr := handleCreateNewRR(zone, s)
-
-	re.M[zone] = append(re.M[zone], rr)
+	re.addRR(zone, rr)
 
 	log.Debugf("Create newRecord: zone=%s, record=%s", zone, rr)
 }
@@ -37,37 +36,49 @@ func (re *RamRecord) newPTRRecord(zone, ptrZone, s string) {
 	log.Debug("handling dns record creation")
 
 	rr := handleCreateNewRR(zone, s)
-
-	re.M[ptrZone] = append(re.M[ptrZone], rr)
+	re.addRR(ptrZone, rr)
 
 	log.Debugf("Create newRecord: zone=%s, record=%s", ptrZone, rr)
 }
 
 // handled zone, trying minimalized needs of code line
-func (re *RamRecord) handleAddZone(zone string, dnsNS map[string]string) {
+// origin is used to qualify relative names from the config,
+// ptr mark reverse zones, where glue is published as PTR
+func (re *RamRecord) handleAddZone(zone, origin string, ptr bool) {
 	log.Debug("handling zone creation")
 
-	// Generate zone SOA record
-	re.newRecord(zone, "@ SOA ns noc-srv.lastmile.sk. "+time.Now().Format("2006010215")+" 7200 3600 1209600 3600")
-
-	// Generate NS record for zone
-	for k, v := range dnsNS {
-		re.newRecord(zone, "@ NS "+k)
-		re.newRecord(zone, k+" A "+cutCIDRMask(v))
-	}
-}
-
-// handled zone, trying minimalized needs of code line
-func (re *RamRecord) handlePTRAddZone(zone, zzone string, dnsNS map[string]string) {
-	log.Debug("handling zone creation")
+	cfg := re.Config.zone(zone)
 
 	// Generate zone SOA record
-	re.newRecord(zone, "@ SOA ns.lastmile.sk. noc-srv.lastmile.sk. "+time.Now().Format("2006010215")+" 7200 3600 1209600 3600")
+	re.newRecord(zone, fmt.Sprintf("@ SOA %s %s %d %d %d %d %d",
+		qualify(cfg.SOA.Mname, origin), qualify(cfg.SOA.Rname, origin), re.Config.initialSerial(),
+		cfg.SOA.Refresh, cfg.SOA.Retry, cfg.SOA.Expire, cfg.SOA.Minttl))
 
 	// Generate NS record for zone
-	for k, v := range dnsNS {
-		re.newRecord(zone, "@ NS "+k+"."+zzone)
-		re.newRecord(zone, createRe(v)+" PTR "+k+"."+zzone)
+	for _, ns := range cfg.NS {
+		name := qualify(ns.Name, origin)
+		re.newRecord(zone, "@ NS "+name)
+
+		// Generate glue, only if it belongs to the zone
+		for _, ip := range []net.IP{ns.IPv4, ns.IPv6} {
+			if ip == nil {
+				continue
+			}
+			if ptr {
+				if re.Config.ptrZone(ip.String()) == zone {
+					re.newRecord(zone, re.Config.ptrName(ip.String())+" PTR "+name)
+				}
+				continue
+			}
+			if !dns.IsSubDomain(zone, name) {
+				continue
+			}
+			if ip.To4() != nil {
+				re.newRecord(zone, name+" A "+ip.String())
+			} else {
+				re.newRecord(zone, name+" AAAA "+ip.String())
+			}
+		}
 	}
 }
 
@@ -77,7 +88,11 @@ func cutCIDRMask(ip string) string {
 
 	ipvAddr, _, err := net.ParseCIDR(ip)
 	if err != nil {
-		log.Errorf("error parse IP address: err=%s\n", err)
+		// Address may be already without CIDRMask
+		if ipvAddr = net.ParseIP(ip); ipvAddr == nil {
+			log.Errorf("error parse IP address: err=%s\n", err)
+			return ""
+		}
 	}
 	return ipvAddr.String()
 }
@@ -89,40 +104,6 @@ func parseZone(name string) string {
 	return name
 }
 
-// createRe Create reverse ADDPREESS
-func createRe(ip string) string {
-	a, err := dns.ReverseAddr(cutCIDRMask(ip))
-	if err != nil {
-		log.Debugf("Issue generate ReverseAddr error= %s", err)
-	}
-	return a
-}
-
-// parsePTRzone Create reverse ZONE
-func parsePTRzone(ipFamily int8, ip string) string {
-	// Convert IP to zone name
-	newIP := cutCIDRMask(ip)
-
-	if ipFamily == 4 {
-		newIP = newIP + "/24"
-	} else {
-		newIP = newIP + "/32"
-	}
-
-	_, zone, err := net.ParseCIDR(newIP)
-	if err != nil {
-		log.Error("failed to parse IP address")
-	}
-
-	dd, err := dns.ReverseAddr(zone.IP.String())
-	dd = strings.Replace(dd, "0.", "", 1)
-	if err != nil {
-		log.Debugf("Issue generate ReverseAddr error= %s", err)
-	}
-
-	return dd
-}
-
 // handleRemoveRecord Use to help remove records from the zone
 func (re *RamRecord) handleRemoveRecord(zone, ptrzone, s string) {
 
@@ -132,13 +113,59 @@ func (re *RamRecord) handleRemoveRecord(zone, ptrzone, s string) {
 		zone = ptrzone
 	}
 	// Find && deleted record from zone
+	if !re.removeRR(zone, rr) {
+		log.Debugf("Unable to find record, got %s", rr)
+	}
+}
+
+// addRR append record to the zone, identical record
+// already in the zone isn't duplicated
+func (re *RamRecord) addRR(zone string, rr dns.RR) {
+	if containsRR(re.M[zone], rr) {
+		log.Debugf("Record already in the zone: zone=%s, record=%s", zone, rr)
+		return
+	}
+	re.M[zone] = append(re.M[zone], rr)
+	re.recordAdded(zone, rr)
+}
+
+// removeRR remove record from the zone, return false if it isn't in the zone
+func (re *RamRecord) removeRR(zone string, rr dns.RR) bool {
 	for record, rrD := range re.M[zone] {
 		if dns.IsDuplicate(rrD, rr) {
-			re.M[zone][record] = re.M[zone][len(re.M[zone])-1]
-			re.M[zone][len(re.M[zone])-1] = nil
-			re.M[zone] = re.M[zone][:len(re.M[zone])-1]
-			return
+			// Copy the records, slice can be shared with published snapshot
+			records := make([]dns.RR, 0, len(re.M[zone])-1)
+			records = append(records, re.M[zone][:record]...)
+			re.M[zone] = append(records, re.M[zone][record+1:]...)
+			re.recordRemoved(zone, rrD)
+			return true
 		}
 	}
-	log.Debugf("Unable to find record, got %s", rr)
+	return false
+}
+
+// recordAdded note added record to changes of running update
+func (re *RamRecord) recordAdded(zone string, rr dns.RR) {
+	if re.changes != nil {
+		re.changes.Added = append(re.changes.Added, rr)
+		re.zoneChangesOf(zone).Added = append(re.zoneChangesOf(zone).Added, rr)
+	}
+}
+
+// recordRemoved note removed record to changes of running update
+func (re *RamRecord) recordRemoved(zone string, rr dns.RR) {
+	if re.changes != nil {
+		re.changes.Removed = append(re.changes.Removed, rr)
+		re.zoneChangesOf(zone).Removed = append(re.zoneChangesOf(zone).Removed, rr)
+	}
+}
+
+// zoneChangesOf returns changes of the zone in running update
+func (re *RamRecord) zoneChangesOf(zone string) *Changes {
+	c, ok := re.zoneChanges[zone]
+	if !ok {
+		c = new(Changes)
+		re.zoneChanges[zone] = c
+	}
+	return c
 }
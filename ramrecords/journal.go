@@ -0,0 +1,83 @@
+package ramrecords
+
+import (
+	"github.com/miekg/dns"
+)
+
+// Delta is single change of the zone between two SOA serials
+type Delta struct {
+	From    *dns.SOA // SOA before the change
+	To      *dns.SOA // SOA after the change
+	Removed []dns.RR
+	Added   []dns.RR
+}
+
+// commitZone bump serial of changed zone and write the change to the journal,
+// must be called with mu held
+func (re *RamRecord) commitZone(zone string, c *Changes) {
+	// Zone was created by the update, there is no previous serial
+	for _, rr := range c.Added {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			return
+		}
+	}
+
+	records := re.M[zone]
+	for i, rr := range records {
+		old, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+
+		soa := dns.Copy(old).(*dns.SOA)
+		soa.Serial = re.Config.nextSerial(old.Serial)
+
+		// Copy the records, slice can be shared with published snapshot
+		records = append([]dns.RR(nil), records...)
+		records[i] = soa
+		re.M[zone] = records
+
+		re.addDelta(zone, Delta{From: old, To: soa, Removed: c.Removed, Added: c.Added})
+		return
+	}
+}
+
+// addDelta append delta to the zone journal, oldest deltas
+// are dropped when the journal is full
+func (re *RamRecord) addDelta(zone string, d Delta) {
+	if re.Config.Journal <= 0 {
+		return
+	}
+
+	deltas := append(re.journal[zone], d)
+	if len(deltas) > re.Config.Journal {
+		deltas = deltas[len(deltas)-re.Config.Journal:]
+	}
+	re.journal[zone] = deltas
+}
+
+// IXFR returns incremental transfer of the zone from serial to current SOA,
+// false is returned when serial isn't in the journal anymore
+func (s *Snapshot) IXFR(zone string, serial uint32) ([]dns.RR, bool) {
+	deltas := s.Journal[zone]
+
+	for i, d := range deltas {
+		if d.From.Serial != serial {
+			continue
+		}
+
+		current := deltas[len(deltas)-1].To
+		rrs := []dns.RR{current}
+		for _, d := range deltas[i:] {
+			rrs = append(rrs, d.From)
+			rrs = append(rrs, d.Removed...)
+			rrs = append(rrs, d.To)
+			rrs = append(rrs, d.Added...)
+		}
+		rrs = append(rrs, current)
+
+		return rrs, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,242 @@
+package ramrecords
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// persistVersion is version of the format written by Save
+const persistVersion = 1
+
+// persisted is on-disk representation of RamRecord,
+// records are stored in presentation format
+type persisted struct {
+	Version int
+	Zones   []string
+	Records map[string][]string
+	Data    map[string]map[string]persistedData // Custom record data by name and address
+}
+
+// persistedData is custom record data of single address,
+// custom fields are stored as JSON returned by nautobot
+type persistedData struct {
+	CustomFields []byte
+	Tags         []string
+}
+
+// Save write all zones, records and custom record data to w
+func (re *RamRecord) Save(w io.Writer) error {
+	re.mu.Lock()
+	snap := re.Snapshot()
+	data, err := encodeData(re.data)
+	re.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	p := persisted{
+		Version: persistVersion,
+		Zones:   snap.Zones,
+		Records: make(map[string][]string, len(snap.M)),
+		Data:    data,
+	}
+	for zone, records := range snap.M {
+		rrs := make([]string, 0, len(records))
+		for _, rr := range records {
+			rrs = append(rrs, rr.String())
+		}
+		p.Records[zone] = rrs
+	}
+
+	return gob.NewEncoder(w).Encode(&p)
+}
+
+// Load replace all zones and records by the data written by Save,
+// records are published without bumping serials. Zones and records
+// which the config maps elsewhere are dropped, resync adds them again.
+func (re *RamRecord) Load(r io.Reader) error {
+	var p persisted
+	if err := gob.NewDecoder(r).Decode(&p); err != nil {
+		return err
+	}
+	if p.Version != persistVersion {
+		return fmt.Errorf("unsupported snapshot version %d", p.Version)
+	}
+
+	m := make(map[string][]dns.RR, len(p.Records))
+	for zone, records := range p.Records {
+		rrs := make([]dns.RR, 0, len(records))
+		seen := make(map[string]bool, len(records))
+		for _, s := range records {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				return fmt.Errorf("invalid record in zone %s: %s", zone, err)
+			}
+			// Older snapshots may contain duplicated records
+			if !seen[rr.String()] {
+				seen[rr.String()] = true
+				rrs = append(rrs, rr)
+			}
+		}
+		m[zone] = rrs
+	}
+	data, err := decodeData(p.Data)
+	if err != nil {
+		return err
+	}
+
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	re.Zones, re.M = re.Config.dropStale(p.Zones, m)
+	re.journal = make(map[string][]Delta)
+	re.data = data
+
+	// Zones configured after the snapshot was written
+	for _, zone := range re.Config.Authoritative {
+		re.ensureZone(zone, zone, false)
+	}
+	re.publish()
+
+	return nil
+}
+
+// encodeData convert custom record data to the on-disk representation
+func encodeData(data map[string]map[string]RecordData) (map[string]map[string]persistedData, error) {
+	out := make(map[string]map[string]persistedData, len(data))
+	for host, ips := range data {
+		out[host] = make(map[string]persistedData, len(ips))
+		for ip, d := range ips {
+			fields, err := json.Marshal(d.CustomFields)
+			if err != nil {
+				return nil, fmt.Errorf("invalid custom fields of %s: %s", host, err)
+			}
+			out[host][ip] = persistedData{CustomFields: fields, Tags: d.Tags}
+		}
+	}
+	return out, nil
+}
+
+// decodeData convert custom record data written by Save,
+// snapshots of older versions have no data
+func decodeData(data map[string]map[string]persistedData) (map[string]map[string]RecordData, error) {
+	out := make(map[string]map[string]RecordData, len(data))
+	for host, ips := range data {
+		out[host] = make(map[string]RecordData, len(ips))
+		for ip, d := range ips {
+			var fields map[string]interface{}
+			if err := json.Unmarshal(d.CustomFields, &fields); err != nil {
+				return nil, fmt.Errorf("invalid custom fields of %s: %s", host, err)
+			}
+			out[host][ip] = RecordData{CustomFields: fields, Tags: d.Tags}
+		}
+	}
+	return out, nil
+}
+
+// dropStale remove zones and records of snapshot written with other zone layout,
+// zones which held only stale records are removed too
+func (c Config) dropStale(zones []string, m map[string][]dns.RR) ([]string, map[string][]dns.RR) {
+	kept := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		if !c.mapsZone(zone) {
+			log.Warningf("Drop zone %s of snapshot, it isn't served anymore", zone)
+			delete(m, zone)
+			continue
+		}
+
+		// Glue records of name servers are always kept
+		ns := make(map[string]bool)
+		for _, rr := range m[zone] {
+			if r, ok := rr.(*dns.NS); ok {
+				ns[strings.ToLower(r.Ns)] = true
+			}
+		}
+
+		records := make([]dns.RR, 0, len(m[zone]))
+		stale, addrs := 0, 0
+		for _, rr := range m[zone] {
+			switch {
+			case ns[rr.Header().Name]:
+				records = append(records, rr)
+			case c.staleRecord(zone, rr):
+				stale++
+			case isAddress(rr):
+				addrs++
+				records = append(records, rr)
+			default:
+				records = append(records, rr)
+			}
+		}
+		if stale > 0 && addrs == 0 && !c.authoritative(zone) {
+			log.Warningf("Drop zone %s of snapshot, all its records are served by other zones", zone)
+			delete(m, zone)
+			continue
+		}
+		if stale > 0 {
+			log.Warningf("Drop %d records of zone %s from snapshot, they are served by other zones", stale, zone)
+		}
+		m[zone] = records
+		kept = append(kept, zone)
+	}
+
+	return kept, m
+}
+
+// mapsZone check if forward zone can be served with the config
+func (c Config) mapsZone(zone string) bool {
+	return isReverseZone(zone) || len(c.Authoritative) == 0 || c.authoritative(zone)
+}
+
+// authoritative check if zone is configured authoritative zone
+func (c Config) authoritative(zone string) bool {
+	for _, z := range c.Authoritative {
+		if z == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// staleRecord check if address record doesn't belong to the zone by the config,
+// PTR and classless CNAME are stale also when reverse prefixes were changed
+func (c Config) staleRecord(zone string, rr dns.RR) bool {
+	name := rr.Header().Name
+	switch r := rr.(type) {
+	case *dns.A, *dns.AAAA:
+		return c.zoneFor(name) != zone
+	case *dns.PTR:
+		ip := ptrAddress(name)
+		return ip == "" || c.ptrZone(ip) != zone || c.ptrName(ip) != name
+	case *dns.CNAME:
+		if !isReverseZone(zone) {
+			return false
+		}
+		ip := ptrAddress(name)
+		if ip == "" {
+			return true
+		}
+		cname := c.classlessCNAME(ip)
+		return cname == nil || cname.Target != r.Target
+	}
+	return false
+}
+
+// isAddress check if record is A, AAAA or PTR record of an address
+func isAddress(rr dns.RR) bool {
+	switch rr.(type) {
+	case *dns.A, *dns.AAAA, *dns.PTR:
+		return true
+	}
+	return false
+}
+
+// isReverseZone check if zone is IPv4 or IPv6 reverse zone
+func isReverseZone(zone string) bool {
+	return dns.IsSubDomain("in-addr.arpa.", zone) || dns.IsSubDomain("ip6.arpa.", zone)
+}
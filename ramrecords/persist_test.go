@@ -0,0 +1,136 @@
+package ramrecords
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestLoadOtherLayout(t *testing.T) {
+	cfg := Config{Default: ZoneConfig{NS: []NameServer{{Name: "ns1"}}}}
+
+	// Snapshot written with zones derived from the names
+	old := newTestRecords(t, cfg, testAddress{4, "10.26.26.1/24", "a.b.layout.test"}, testAddress{4, "10.26.26.2/24", "c.layout.test"})
+	var buf bytes.Buffer
+	if err := old.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		authoritative []string
+		zones         []string
+		records       map[string]int
+	}{
+		{
+			name:          "Zone isn't served anymore",
+			authoritative: []string{"layout.test."},
+			zones:         []string{"26.26.10.in-addr.arpa.", "layout.test."},
+			records:       map[string]int{"a.b.layout.test.": 0, "c.layout.test.": 1},
+		},
+		{
+			name:          "Name moved to other zone",
+			authoritative: []string{"b.layout.test.", "c.layout.test."},
+			zones:         []string{"26.26.10.in-addr.arpa.", "b.layout.test.", "c.layout.test."},
+			records:       map[string]int{"a.b.layout.test.": 1, "c.layout.test.": 0},
+		},
+		{
+			name:          "Authoritative zone keeps only its records",
+			authoritative: []string{"layout.test.", "c.layout.test."},
+			zones:         []string{"26.26.10.in-addr.arpa.", "c.layout.test.", "layout.test."},
+			records:       map[string]int{"a.b.layout.test.": 0, "c.layout.test.": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg
+			c.Authoritative = tt.authoritative
+			re, _ := InitRamRecords(c)
+			if err := re.Load(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			snap := re.Snapshot()
+			if len(snap.Zones) != len(tt.zones) {
+				t.Errorf("Expected zones %v, got %v", tt.zones, snap.Zones)
+			}
+			for _, zone := range tt.zones {
+				if _, ok := snap.M[zone]; !ok {
+					t.Errorf("Expected zone %s, got %v", zone, snap.Zones)
+				}
+			}
+			for name, want := range tt.records {
+				if got := recordsOf(re, re.Config.zoneFor(name), name, dns.TypeA); len(got) != want {
+					t.Errorf("Expected %d A records of %s, got %v", want, name, got)
+				}
+			}
+			for _, a := range re.Addresses() {
+				if re.Config.zoneFor(a.DnsName) == "" {
+					t.Errorf("Unexpected record of stale zone %v", a)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadOtherReverse(t *testing.T) {
+	cfg := Config{Default: ZoneConfig{NS: []NameServer{{Name: "ns1"}}}}
+
+	// Snapshot written with default /24 reverse zones
+	old := newTestRecords(t, cfg, testAddress{4, "10.26.27.70/24", "a.reverse.test"})
+	var buf bytes.Buffer
+	if err := old.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	_, prefix, _ := net.ParseCIDR("10.26.27.64/26")
+	cfg.Reverse = []*net.IPNet{prefix}
+	re, _ := InitRamRecords(cfg)
+	if err := re.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// Zone held only PTR of the classless zone
+	if _, ok := re.Snapshot().M["27.26.10.in-addr.arpa."]; ok {
+		t.Errorf("Expected stale reverse zone dropped, got %v", re.Snapshot().Zones)
+	}
+
+	// Resync adds the PTR to the classless zone
+	re.AddAddress(4, "10.26.27.70/24", "a.reverse.test")
+	if got := recordsOf(re, "64/26.27.26.10.in-addr.arpa.", "70.64/26.27.26.10.in-addr.arpa.", dns.TypePTR); len(got) != 1 {
+		t.Errorf("Expected PTR in classless zone, got %v", got)
+	}
+}
+
+func TestLoadCustomData(t *testing.T) {
+	old := newTestRecords(t, customConfig, customHost, testAddress{4, "10.19.19.2/24", "host.custom.test."})
+	old.SetNameData("host.custom.test.", map[string]RecordData{
+		"10.19.19.1": {CustomFields: map[string]interface{}{"dns_aliases": []interface{}{"www.custom.test"}}},
+		"10.19.19.2": {Tags: []string{"cname:ftp.custom.test"}},
+	})
+	var buf bytes.Buffer
+	if err := old.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	re, _ := InitRamRecords(old.Config)
+	if err := re.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// Change of one address keeps records of the other addresses of the name
+	re.Batch(func(tx *Tx) error {
+		return tx.SetAddressData("host.custom.test.", "10.19.19.2/24", RecordData{Tags: []string{"cname:git.custom.test"}})
+	})
+	got := customStrings(re, "host.custom.test.")
+	sort.Strings(got)
+	want := []string{"git.custom.test. 3600 IN CNAME host.custom.test.", "www.custom.test. 3600 IN CNAME host.custom.test."}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected custom records %q, got %q", want, got)
+	}
+}
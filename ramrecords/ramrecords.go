@@ -1,17 +1,50 @@
 package ramrecords
 
 import (
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/miekg/dns"
 )
 
+// RamRecord holds all zones and records. Zones and M are owned by writers and
+// guarded by mu, readers should use Snapshot, which is never modified once it is
+// published. Writers never change a record slice in place, they always copy it,
+// so published snapshots can share the slices with M.
 type RamRecord struct {
-	Zones []string            // Array of zones
-	M     map[string][]dns.RR // Map of DNS Records
+	Zones  []string            // Array of zones
+	M      map[string][]dns.RR // Map of DNS Records
+	Config Config              // Name servers and SOA of the zones
+
+	mu          sync.Mutex                       // Serialize writers
+	snap        atomic.Value                     // Latest published *Snapshot
+	changes     *Changes                         // Records changed by running update
+	zoneChanges map[string]*Changes              // Records changed by running update per zone
+	journal     map[string][]Delta               // Journal of zone changes, used for IXFR
+	data        map[string]map[string]RecordData // Custom record data by name and address
+	hooks       []func([]string)                 // Called with zones changed by update
+}
+
+// Changes are records added and removed by single update
+type Changes struct {
+	Added   []dns.RR
+	Removed []dns.RR
+}
+
+// Snapshot is a read-only copy of zones and records at a point of time
+type Snapshot struct {
+	Zones   []string            // Array of zones
+	M       map[string][]dns.RR // Map of DNS Records
+	Journal map[string][]Delta  // Journal of zone changes
 }
 
+// ErrNotAuthoritative is returned for names which aren't in any authoritative zone
+var ErrNotAuthoritative = errors.New("name isn't in any authoritative zone")
+
 // Init log variable
 var log = clog.NewWithPlugin("nautobotor")
 
@@ -20,149 +53,289 @@ func New() *RamRecord {
 	log.Debug("initializing RamRecord struct")
 	n := new(RamRecord)
 	n.M = make(map[string][]dns.RR)
+	n.journal = make(map[string][]Delta)
+	n.data = make(map[string]map[string]RecordData)
+	n.publish()
 	return n
 }
 
-// AddZone handling proces to generate all necessary zone records wtih multiple types
-func (re *RamRecord) AddZone(dnsName string, dnsNS map[string]string) {
-	log.Debug("adding zone to zones array")
-	zone := parseZone(dnsName)
-
-	// If zone is empty
-	if re.Zones == nil {
-		re.Zones = make([]string, 1)
-		re.Zones = []string{zone}
-
-		re.handleAddZone(zone, dnsNS)
-	} else {
-		// If zone already exists
-		for _, z := range re.Zones {
-			if z == zone {
-				return
-			}
+// Snapshot returns the latest published zones and records,
+// it is safe to be used concurrently with writers without locking
+func (re *RamRecord) Snapshot() *Snapshot {
+	if s, ok := re.snap.Load().(*Snapshot); ok {
+		return s
+	}
+	return &Snapshot{}
+}
+
+// update run fn with mu held, publish the result
+// return records changed by fn
+func (re *RamRecord) update(fn func()) *Changes {
+	changes, zones, hooks := re.apply(fn)
+
+	// Hooks are called without lock, they can read the published snapshot
+	if len(zones) > 0 {
+		for _, h := range hooks {
+			h(zones)
 		}
-		// If not, add zone to the struct
-		re.Zones = append(re.Zones, zone)
+	}
+
+	return changes
+}
+
+// apply run fn with mu held, commit and publish changed zones
+func (re *RamRecord) apply(fn func()) (*Changes, []string, []func([]string)) {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	re.changes = new(Changes)
+	re.zoneChanges = make(map[string]*Changes)
+	defer func() { re.changes, re.zoneChanges = nil, nil }()
+
+	fn()
 
-		re.handleAddZone(zone, dnsNS)
+	zones := make([]string, 0, len(re.zoneChanges))
+	for zone, c := range re.zoneChanges {
+		re.commitZone(zone, c)
+		zones = append(zones, zone)
 	}
+	re.publish()
+
+	return re.changes, zones, re.hooks
+}
+
+// OnChange register function called with zones changed by every update,
+// it is called after the change is published
+func (re *RamRecord) OnChange(fn func(zones []string)) {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	re.hooks = append(re.hooks, fn)
+}
+
+// publish make current zones and records visible to readers,
+// must be called with mu held
+func (re *RamRecord) publish() {
+	s := &Snapshot{
+		Zones:   make([]string, len(re.Zones)),
+		M:       make(map[string][]dns.RR, len(re.M)),
+		Journal: make(map[string][]Delta, len(re.journal)),
+	}
+	copy(s.Zones, re.Zones)
+	for zone, records := range re.M {
+		s.M[zone] = records[:len(records):len(records)]
+	}
+	for zone, deltas := range re.journal {
+		s.Journal[zone] = deltas[:len(deltas):len(deltas)]
+	}
+
+	re.snap.Store(s)
+}
+
+// AddZone handling proces to generate all necessary zone records wtih multiple types
+func (re *RamRecord) AddZone(dnsName string) *Changes {
+	return re.update(func() { re.addZone(dnsName) })
+}
+
+func (re *RamRecord) addZone(dnsName string) {
+	log.Debug("adding zone to zones array")
+	zone := re.Config.zoneFor(dnsName)
+	if zone == "" {
+		log.Warningf("Name %s isn't in any authoritative zone", dnsName)
+		return
+	}
+
+	re.ensureZone(zone, zone, false)
 }
 
 // AddPTRZone handling proces to generate all necessary PTR zone records wtih multiple types
-func (re *RamRecord) AddPTRZone(ipFamily int8, ip, dnsName string, dnsNS map[string]string) {
-	log.Debug("adding PTR zone to zones array")
+func (re *RamRecord) AddPTRZone(ipFamily int8, ip, dnsName string) *Changes {
+	return re.update(func() { re.addPTRZone(ipFamily, ip, dnsName) })
+}
 
-	zone := parsePTRzone(ipFamily, ip)
+func (re *RamRecord) addPTRZone(ipFamily int8, ip, dnsName string) {
+	log.Debug("adding PTR zone to zones array")
+	origin := re.Config.zoneFor(dnsName)
+	if origin == "" {
+		log.Warningf("Name %s isn't in any authoritative zone", dnsName)
+		return
+	}
 
-	// If zone is empty
-	if re.Zones == nil {
-		re.Zones = make([]string, 1)
-		re.Zones = []string{zone}
+	re.ensureZone(re.Config.ptrZone(ip), origin, true)
+}
 
-		re.handleAddZone(zone, dnsNS)
-	} else {
-		// If zone already exists
-		for _, z := range re.Zones {
-			if z == zone {
-				return
-			}
+// ensureZone add the zone with SOA and NS records, if it doesn't exist yet
+func (re *RamRecord) ensureZone(zone, origin string, ptr bool) {
+	for _, z := range re.Zones {
+		if z == zone {
+			return
 		}
-		// If not, add zone to the struct
-		re.Zones = append(re.Zones, zone)
+	}
 
-		re.handlePTRAddZone(zone, parseZone(dnsName), dnsNS)
+	re.Zones = append(re.Zones, zone)
+	re.handleAddZone(zone, origin, ptr)
+	if ptr {
+		re.moveClasslessCNAMEs(zone)
 	}
 }
 
 // RemoveRecord remove a record from zone
-func (re *RamRecord) RemoveRecord(ipFamily int8, ip, dnsName string) {
-	zone := parseZone(dnsName)
+func (re *RamRecord) RemoveRecord(ipFamily int8, ip, dnsName string) *Changes {
+	return re.update(func() { re.removeRecord(ipFamily, ip, dnsName) })
+}
+
+func (re *RamRecord) removeRecord(ipFamily int8, ip, dnsName string) {
+	zone := re.Config.zoneFor(dnsName)
+	if zone == "" {
+		return
+	}
+	name := strings.ToLower(dns.Fqdn(dnsName))
 
 	switch ipFamily {
 	case 4:
 		// Delete A
-		re.handleRemoveRecord(zone, "", strings.Split(dnsName, ".")[0]+" A "+cutCIDRMask(ip))
-		// Delete PTR
-		re.handleRemoveRecord(parseZone(dnsName), parsePTRzone(ipFamily, ip), createRe(ip)+" PTR "+strings.Split(dnsName, ".")[0])
+		re.handleRemoveRecord(zone, "", name+" A "+cutCIDRMask(ip))
 	case 6:
-		re.handleRemoveRecord(zone, "", strings.Split(dnsName, ".")[0]+" AAAA "+cutCIDRMask(ip))
-		re.handleRemoveRecord(parseZone(dnsName), parsePTRzone(ipFamily, ip), createRe(ip)+" PTR "+strings.Split(dnsName, ".")[0])
+		re.handleRemoveRecord(zone, "", name+" AAAA "+cutCIDRMask(ip))
+	default:
+		return
 	}
-
+	// Delete PTR
+	re.handleRemoveRecord(zone, re.Config.ptrZone(ip), re.Config.ptrName(ip)+" PTR "+name)
+	re.releaseClasslessCNAME(ip)
 }
 
 // AddRecord adds a record to the zone
-func (re *RamRecord) AddRecord(ipFamily int8, ip, dnsName string) {
+func (re *RamRecord) AddRecord(ipFamily int8, ip, dnsName string) *Changes {
+	return re.update(func() { re.addRecord(ipFamily, ip, dnsName) })
+}
+
+func (re *RamRecord) addRecord(ipFamily int8, ip, dnsName string) {
 	log.Debug("adding record to the zone records array")
+	zone := re.Config.zoneFor(dnsName)
+	if zone == "" {
+		log.Warningf("Name %s isn't in any authoritative zone", dnsName)
+		return
+	}
+	name := strings.ToLower(dns.Fqdn(dnsName))
 
-	// TODO: need to implement way to handle different types of DNS record
+	// Other types of records are generated by custom record data
 	switch ipFamily {
 	case 4:
 		// Add A
-		re.newRecord(parseZone(dnsName), strings.Split(dnsName, ".")[0]+" A "+cutCIDRMask(ip))
+		re.newRecord(zone, name+" A "+cutCIDRMask(ip))
 	case 6:
 		// Add AAAA
-		re.newRecord(parseZone(dnsName), strings.Split(dnsName, ".")[0]+" AAAA "+cutCIDRMask(ip))
+		re.newRecord(zone, name+" AAAA "+cutCIDRMask(ip))
+	default:
+		return
 	}
 
-	re.newPTRRecord(parseZone(dnsName), parsePTRzone(ipFamily, ip), createRe(ip)+" PTR "+strings.Split(dnsName, ".")[0])
+	re.newPTRRecord(zone, re.Config.ptrZone(ip), re.Config.ptrName(ip)+" PTR "+name)
+	re.addClasslessCNAME(ip)
+}
+
+// ZoneFor returns authoritative zone of the DNS name,
+// ErrNotAuthoritative is returned when the name isn't in any zone
+func (re *RamRecord) ZoneFor(dnsName string) (string, error) {
+	zone := re.Config.zoneFor(dnsName)
+	if zone == "" {
+		return "", fmt.Errorf("%w: %s", ErrNotAuthoritative, dnsName)
+	}
+	return zone, nil
 }
 
 // UpdateRecord update a record in the zone
-func (re *RamRecord) UpdateRecord(ipFamily int8, ip, dnsName string, ns map[string]string) {
+func (re *RamRecord) UpdateRecord(ipFamily int8, ip, dnsName string) *Changes {
+	return re.update(func() { re.updateRecord(ipFamily, ip, dnsName) })
+}
+
+func (re *RamRecord) updateRecord(ipFamily int8, ip, dnsName string) {
 	log.Debug("updating record from the zone records array")
 
-	// Prepare variables
-	zone := parseZone(dnsName)
-	ipO := cutCIDRMask(ip)
-
-	for _, record := range re.M[zone] {
-		log.Debug("try find the record in the zone")
-		// try find the record in the zone
-		if ipO == dns.Field(record, 1) {
-			log.Debug("verify if record is correct")
-			// verify if record is correct
-			var s string
-			dnsNameO := record.Header().Name
-			zone := parseZone(dnsNameO)
-
-			switch ipFamily {
-			case 4:
-				s = (strings.Split(dnsNameO, ".")[0] + " A " + cutCIDRMask(ip))
-			case 6:
-				s = (strings.Split(dnsNameO, ".")[0] + " AAAA " + cutCIDRMask(ip))
-			}
+	addr := cutCIDRMask(ip)
+	name := strings.ToLower(dns.Fqdn(dnsName))
+
+	// Find other names of the address, address may be published under multiple names
+	exists := false
+	var stale []Address
+	for _, a := range addresses(re.M) {
+		if a.Address != addr || a.Glue {
+			continue
+		}
+		if a.DnsName == name {
+			exists = true
+			continue
+		}
+		stale = append(stale, a)
+	}
 
-			rr := handleCreateNewRR(zone, s)
+	// Address with single other name was renamed, with more names
+	// it isn't known which one was changed, they are kept until resync
+	switch {
+	case !exists && len(stale) == 1:
+		log.Debugf("rename record %s to %s", stale[0].DnsName, name)
+		re.removeRecord(stale[0].Family, stale[0].Address, stale[0].DnsName)
+		re.dropAddressData(stale[0].DnsName, stale[0].Address)
+	case !exists && len(stale) > 1:
+		log.Debugf("address %s has multiple names, add %s and keep the others", addr, name)
+	}
 
-			if dns.IsDuplicate(record, rr) {
-				// If the record is corret => (deleted, create new one) = Update record
-				log.Debug("delete record, creating new record")
+	// Records already in the zone are not duplicated
+	re.addZone(dnsName)
+	re.addPTRZone(ipFamily, ip, dnsName)
+	re.addRecord(ipFamily, ip, dnsName)
+}
 
-				// remove existing record
-				re.RemoveRecord(ipFamily, ip, dnsNameO)
-				// add new record
-				re.AddRecord(ipFamily, ip, dnsName)
+// Address is a single A or AAAA record stored in the forward zones
+type Address struct {
+	Family  int8
+	Address string // IP address without CIDRMask
+	DnsName string // FQDN of the record
+	Glue    bool   // Record is a glue of the zone name server
+}
+
+// Addresses returns all A and AAAA records stored in the zones
+func (re *RamRecord) Addresses() []Address {
+	return addresses(re.Snapshot().M)
+}
+
+// addresses returns all A and AAAA records of the zones
+func addresses(m map[string][]dns.RR) []Address {
+	var addrs []Address
+
+	for _, records := range m {
+		// Collect name servers of the zone, to be able mark glue records
+		ns := make(map[string]bool)
+		for _, rr := range records {
+			if r, ok := rr.(*dns.NS); ok {
+				ns[strings.ToLower(r.Ns)] = true
 			}
+		}
 
-			return
+		for _, rr := range records {
+			switch r := rr.(type) {
+			case *dns.A:
+				addrs = append(addrs, Address{Family: 4, Address: r.A.String(), DnsName: r.Hdr.Name, Glue: ns[r.Hdr.Name]})
+			case *dns.AAAA:
+				addrs = append(addrs, Address{Family: 6, Address: r.AAAA.String(), DnsName: r.Hdr.Name, Glue: ns[r.Hdr.Name]})
+			}
 		}
 	}
-	// If record isn't in the zone, create it
-	log.Debug("updating faild: record isn't in the zone, create it")
-	// Handle Normal zone
-	re.AddZone(dnsName, ns)
-	// Handle PTR zones
-	re.AddPTRZone(ipFamily, ip, dnsName, ns)
-	re.AddRecord(ipFamily, ip, dnsName)
-}
 
-// TODO: need to handle duplicated FQDN records
-// May useful this function
-// dns.IsDuplicate()
+	return addrs
+}
 
-func InitRamRecords() (*RamRecord, error) {
+func InitRamRecords(cfg Config) (*RamRecord, error) {
 	re := New()
+	re.Config = cfg
+
+	// Authoritative zones are served even without records
+	re.update(func() {
+		for _, zone := range cfg.Authoritative {
+			re.ensureZone(zone, zone, false)
+		}
+	})
 
 	return re, nil
 }
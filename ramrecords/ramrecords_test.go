@@ -0,0 +1,234 @@
+package ramrecords
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// testAddress is address added to the zones of test RamRecord
+type testAddress struct {
+	family   int8
+	ip, name string
+}
+
+// newTestRecords returns RamRecord of the config with the addresses added by AddAddress
+func newTestRecords(t *testing.T, cfg Config, addrs ...testAddress) *RamRecord {
+	t.Helper()
+	re, err := InitRamRecords(cfg)
+	if err != nil {
+		t.Fatalf("InitRamRecords() error = %v", err)
+	}
+	for _, a := range addrs {
+		if _, err := re.AddAddress(a.family, a.ip, a.name); err != nil {
+			t.Fatalf("AddAddress() error = %v", err)
+		}
+	}
+	return re
+}
+
+// recordsOf returns records of the name and type in presentation format
+func recordsOf(re *RamRecord, zone, name string, t uint16) []string {
+	var s []string
+	for _, rr := range re.Snapshot().M[zone] {
+		if rr.Header().Name == name && rr.Header().Rrtype == t {
+			s = append(s, strings.Fields(rr.String())[4])
+		}
+	}
+	sort.Strings(s)
+	return s
+}
+
+func TestDuplicatedRecords(t *testing.T) {
+	re := New()
+
+	re.AddAddress(4, "10.20.20.1/24", "a.dup.test")
+	changes := re.AddRecord(4, "10.20.20.1/24", "a.dup.test")
+	if len(changes.Added) != 0 {
+		t.Errorf("Expected no records added twice, got %v", changes.Added)
+	}
+	if got := recordsOf(re, "dup.test.", "a.dup.test.", dns.TypeA); len(got) != 1 {
+		t.Errorf("Expected single A record, got %v", got)
+	}
+	if got := recordsOf(re, "20.20.10.in-addr.arpa.", "1.20.20.10.in-addr.arpa.", dns.TypePTR); len(got) != 1 {
+		t.Errorf("Expected single PTR record, got %v", got)
+	}
+}
+
+func TestMultipleAddressesPerName(t *testing.T) {
+	re := New()
+
+	// Round-robin name with IPv4 and IPv6 addresses
+	re.AddAddress(4, "10.21.21.1/24", "rr.multi.test")
+	re.AddAddress(4, "10.21.21.2/24", "rr.multi.test")
+	re.AddAddress(6, "2001:db8::1/64", "rr.multi.test")
+
+	if got := recordsOf(re, "multi.test.", "rr.multi.test.", dns.TypeA); len(got) != 2 {
+		t.Errorf("Expected 2 A records, got %v", got)
+	}
+
+	// Removing one address keeps the others
+	re.RemoveRecord(4, "10.21.21.1/24", "rr.multi.test")
+	if got := recordsOf(re, "multi.test.", "rr.multi.test.", dns.TypeA); len(got) != 1 || got[0] != "10.21.21.2" {
+		t.Errorf("Expected only 10.21.21.2, got %v", got)
+	}
+	if got := recordsOf(re, "multi.test.", "rr.multi.test.", dns.TypeAAAA); len(got) != 1 {
+		t.Errorf("Expected AAAA record kept, got %v", got)
+	}
+	if got := recordsOf(re, "21.21.10.in-addr.arpa.", "1.21.21.10.in-addr.arpa.", dns.TypePTR); len(got) != 0 {
+		t.Errorf("Expected PTR of removed address removed, got %v", got)
+	}
+	if got := recordsOf(re, "21.21.10.in-addr.arpa.", "2.21.21.10.in-addr.arpa.", dns.TypePTR); len(got) != 1 {
+		t.Errorf("Expected PTR of other address kept, got %v", got)
+	}
+}
+
+func TestMultipleNamesPerAddress(t *testing.T) {
+	re := New()
+
+	re.AddAddress(4, "10.22.22.1/24", "a.names.test")
+	re.AddAddress(4, "10.22.22.1/24", "b.names.test")
+
+	ptr := "1.22.22.10.in-addr.arpa."
+	if got := recordsOf(re, "22.22.10.in-addr.arpa.", ptr, dns.TypePTR); len(got) != 2 {
+		t.Errorf("Expected PTR for both names, got %v", got)
+	}
+
+	// Update of existing name doesn't touch the other name
+	re.UpdateRecord(4, "10.22.22.1/24", "a.names.test")
+	if got := recordsOf(re, "names.test.", "b.names.test.", dns.TypeA); len(got) != 1 {
+		t.Errorf("Expected b.names.test. kept, got %v", got)
+	}
+
+	// With multiple names it isn't known which one was renamed, both are kept
+	re.UpdateRecord(4, "10.22.22.1/24", "c.names.test")
+	if got := recordsOf(re, "22.22.10.in-addr.arpa.", ptr, dns.TypePTR); len(got) != 3 {
+		t.Errorf("Expected PTR for all names, got %v", got)
+	}
+
+	// Removing one name keeps the others
+	re.RemoveRecord(4, "10.22.22.1/24", "a.names.test")
+	re.RemoveRecord(4, "10.22.22.1/24", "c.names.test")
+	if got := recordsOf(re, "22.22.10.in-addr.arpa.", ptr, dns.TypePTR); len(got) != 1 || got[0] != "b.names.test." {
+		t.Errorf("Expected only PTR to b.names.test., got %v", got)
+	}
+}
+
+func TestUpdateRecordRename(t *testing.T) {
+	re := New()
+
+	re.AddAddress(4, "10.23.23.1/24", "old.rename.test")
+	re.AddAddress(4, "10.23.23.2/24", "other.rename.test")
+
+	// Address with single name is renamed, also to other zone
+	re.UpdateRecord(4, "10.23.23.1/24", "new.renamed.test")
+
+	if got := recordsOf(re, "rename.test.", "old.rename.test.", dns.TypeA); len(got) != 0 {
+		t.Errorf("Expected old name removed, got %v", got)
+	}
+	if got := recordsOf(re, "renamed.test.", "new.renamed.test.", dns.TypeA); len(got) != 1 {
+		t.Errorf("Expected new name added, got %v", got)
+	}
+	if got := recordsOf(re, "23.23.10.in-addr.arpa.", "1.23.23.10.in-addr.arpa.", dns.TypePTR); len(got) != 1 || got[0] != "new.renamed.test." {
+		t.Errorf("Expected PTR to the new name, got %v", got)
+	}
+	if got := recordsOf(re, "rename.test.", "other.rename.test.", dns.TypeA); len(got) != 1 {
+		t.Errorf("Expected other address untouched, got %v", got)
+	}
+}
+
+func TestAuthoritativeZones(t *testing.T) {
+	re, err := InitRamRecords(Config{
+		Default:       ZoneConfig{NS: []NameServer{{Name: "ns1"}}},
+		Authoritative: []string{"zones.test.", "sub.zones.test."},
+	})
+	if err != nil {
+		t.Fatalf("InitRamRecords() error = %v", err)
+	}
+
+	// Zones are served before any record is added
+	if zones := re.Snapshot().Zones; len(zones) != 2 {
+		t.Errorf("Expected 2 authoritative zones, got %v", zones)
+	}
+
+	tests := []struct {
+		name string
+		zone string
+	}{
+		{"a.b.c.zones.test", "zones.test."},
+		{"zones.test.", "zones.test."},
+		{"A.Sub.Zones.Test.", "sub.zones.test."},
+		{"a.b.sub.zones.test.", "sub.zones.test."},
+		{"a.other.test.", ""},
+		{"notzones.test.", ""},
+	}
+	for _, tt := range tests {
+		zone, err := re.ZoneFor(tt.name)
+		if zone != tt.zone || (err != nil) != (tt.zone == "") {
+			t.Errorf("ZoneFor(%s) = %q, %v, want %q", tt.name, zone, err, tt.zone)
+		}
+	}
+
+	re.AddAddress(4, "10.24.24.1/24", "a.b.c.zones.test")
+	if got := recordsOf(re, "zones.test.", "a.b.c.zones.test.", dns.TypeA); len(got) != 1 {
+		t.Errorf("Expected A record in zones.test., got %v", got)
+	}
+	if got := recordsOf(re, "24.24.10.in-addr.arpa.", "1.24.24.10.in-addr.arpa.", dns.TypePTR); len(got) != 1 || got[0] != "a.b.c.zones.test." {
+		t.Errorf("Expected PTR to the full name, got %v", got)
+	}
+
+	// Name outside of the zones doesn't create new zone
+	re.AddAddress(4, "10.24.24.2/24", "a.other.test")
+	for _, zone := range re.Snapshot().Zones {
+		if zone == "other.test." {
+			t.Errorf("Unexpected zone %s", zone)
+		}
+	}
+
+	re.RemoveRecord(4, "10.24.24.1/24", "a.b.c.zones.test")
+	if got := recordsOf(re, "zones.test.", "a.b.c.zones.test.", dns.TypeA); len(got) != 0 {
+		t.Errorf("Expected A record removed, got %v", got)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	re := New()
+	re.Config.Journal = 10
+	re.AddAddress(4, "10.24.24.1/24", "old.batch.test")
+
+	var calls int
+	re.OnChange(func(zones []string) { calls++ })
+	serial := re.Snapshot().M["batch.test."][0].(*dns.SOA).Serial
+	deltas := len(re.Snapshot().Journal["batch.test."])
+
+	// Rename is published by single update
+	changes, err := re.Batch(func(tx *Tx) error {
+		tx.RemoveAddress(4, "10.24.24.1/24", "old.batch.test")
+		return tx.AddAddress(4, "10.24.24.1/24", "new.batch.test")
+	})
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	if len(changes.Added) != 2 || len(changes.Removed) != 2 {
+		t.Errorf("Expected A and PTR replaced, got %v", changes)
+	}
+	if calls != 1 {
+		t.Errorf("Expected single change notification, got %d", calls)
+	}
+	if got := re.Snapshot().M["batch.test."][0].(*dns.SOA).Serial; got != re.Config.nextSerial(serial) {
+		t.Errorf("Expected single serial bump from %d, got %d", serial, got)
+	}
+	if got := len(re.Snapshot().Journal["batch.test."]); got != deltas+1 {
+		t.Errorf("Expected single journal entry, got %d", got-deltas)
+	}
+
+	// Name out of the zones is rejected without changes
+	re.Config.Authoritative = []string{"batch.test."}
+	changes, err = re.AddAddress(4, "10.24.24.2/24", "host.other")
+	if !errors.Is(err, ErrNotAuthoritative) || len(changes.Added) != 0 {
+		t.Errorf("AddAddress() = %v, %v, want ErrNotAuthoritative", changes, err)
+	}
+}
@@ -0,0 +1,227 @@
+package ramrecords
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Reverse zones of addresses without configured prefix
+var (
+	defaultReverseV4 = net.CIDRMask(24, 32)
+	defaultReverseV6 = net.CIDRMask(32, 128)
+)
+
+// ReverseZone returns name of the reverse zone of the prefix. IPv4 prefix
+// must be on octet boundary, or longer than /24 for RFC 2317 classless zone,
+// IPv6 prefix must be on nibble boundary.
+func ReverseZone(prefix *net.IPNet) (string, error) {
+	ones, bits := prefix.Mask.Size()
+
+	if ip := prefix.IP.To4(); ip != nil && bits == 32 {
+		switch {
+		case ones == 0:
+			return "", fmt.Errorf("prefix %s is too short", prefix)
+		case ones > 24:
+			// RFC 2317, <start>/<length>.<c>.<b>.<a>.in-addr.arpa.
+			return fmt.Sprintf("%d/%d.%d.%d.%d.in-addr.arpa.", ip[3], ones, ip[2], ip[1], ip[0]), nil
+		case ones%8 != 0:
+			return "", fmt.Errorf("prefix %s isn't on octet boundary", prefix)
+		}
+
+		labels := make([]string, 0, ones/8+1)
+		for i := ones/8 - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(ip[i])))
+		}
+		return strings.Join(append(labels, "in-addr.arpa."), "."), nil
+	}
+
+	if ones == 0 || ones%4 != 0 {
+		return "", fmt.Errorf("prefix %s isn't on nibble boundary", prefix)
+	}
+
+	ip := prefix.IP.To16()
+	labels := make([]string, 0, ones/4+1)
+	for i := ones/4 - 1; i >= 0; i-- {
+		b := ip[i/2]
+		if i%2 == 0 {
+			b >>= 4
+		}
+		labels = append(labels, strconv.FormatUint(uint64(b&0xf), 16))
+	}
+	return strings.Join(append(labels, "ip6.arpa."), "."), nil
+}
+
+// reversePrefix returns the longest configured prefix of the address,
+// or the default prefix
+func (c Config) reversePrefix(ip net.IP) *net.IPNet {
+	var prefix *net.IPNet
+	for _, p := range c.Reverse {
+		if p.Contains(ip) && (prefix == nil || prefixLen(p) > prefixLen(prefix)) {
+			prefix = p
+		}
+	}
+	if prefix != nil {
+		return prefix
+	}
+
+	mask := defaultReverseV6
+	if ip.To4() != nil {
+		mask = defaultReverseV4
+	}
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// prefixLen returns length of the prefix
+func prefixLen(p *net.IPNet) int {
+	ones, _ := p.Mask.Size()
+	return ones
+}
+
+// ptrZone returns reverse zone of the address
+func (c Config) ptrZone(ip string) string {
+	addr := net.ParseIP(cutCIDRMask(ip))
+	if addr == nil {
+		return ""
+	}
+
+	zone, err := ReverseZone(c.reversePrefix(addr))
+	if err != nil {
+		log.Errorf("error generate reverse zone: err=%s\n", err)
+	}
+	return zone
+}
+
+// ptrName returns owner of PTR record of the address,
+// in classless zone the last octet is prepended to the zone
+func (c Config) ptrName(ip string) string {
+	addr := net.ParseIP(cutCIDRMask(ip))
+	if addr == nil {
+		return ""
+	}
+
+	if v4 := addr.To4(); v4 != nil && prefixLen(c.reversePrefix(addr)) > 24 {
+		return fmt.Sprintf("%d.%s", v4[3], c.ptrZone(ip))
+	}
+
+	rev, err := dns.ReverseAddr(addr.String())
+	if err != nil {
+		log.Debugf("Issue generate ReverseAddr error= %s", err)
+	}
+	return rev
+}
+
+// ptrAddress returns IP address of PTR owner name, also in RFC 2317 classless zone
+func ptrAddress(name string) string {
+	var labels []string
+	var ip net.IP
+	switch {
+	case dns.IsSubDomain("in-addr.arpa.", name):
+		for _, l := range dns.SplitDomainName(strings.TrimSuffix(name, "in-addr.arpa.")) {
+			// <start>/<length> label of classless zone
+			if !strings.Contains(l, "/") {
+				labels = append(labels, l)
+			}
+		}
+		if len(labels) != net.IPv4len {
+			return ""
+		}
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		ip = net.ParseIP(strings.Join(labels, "."))
+	case dns.IsSubDomain("ip6.arpa.", name):
+		labels = dns.SplitDomainName(strings.TrimSuffix(name, "ip6.arpa."))
+		if len(labels) != 2*net.IPv6len {
+			return ""
+		}
+		var b strings.Builder
+		for i := len(labels) - 1; i >= 0; i-- {
+			b.WriteString(labels[i])
+			if i%4 == 0 && i > 0 {
+				b.WriteByte(':')
+			}
+		}
+		ip = net.ParseIP(b.String())
+	}
+
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// classlessCNAME returns RFC 2317 CNAME of address in classless reverse zone,
+// pointing from the name in the parent zone to the PTR in the classless zone
+func (c Config) classlessCNAME(ip string) *dns.CNAME {
+	addr := net.ParseIP(cutCIDRMask(ip))
+	if addr == nil || addr.To4() == nil || prefixLen(c.reversePrefix(addr)) <= 24 {
+		return nil
+	}
+
+	name, err := dns.ReverseAddr(addr.String())
+	if err != nil {
+		return nil
+	}
+	return &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: customTTL},
+		Target: c.ptrName(ip),
+	}
+}
+
+// addClasslessCNAME add RFC 2317 CNAME of address in classless zone to the parent
+// zone, if it is served. Otherwise the CNAME must be published by owner of the parent zone.
+func (re *RamRecord) addClasslessCNAME(ip string) {
+	cname := re.Config.classlessCNAME(ip)
+	if cname == nil {
+		return
+	}
+	if zone := re.zoneOf(cname.Hdr.Name); zone != "" {
+		re.addRR(zone, cname)
+	}
+}
+
+// releaseClasslessCNAME remove RFC 2317 CNAME of address without PTR records
+func (re *RamRecord) releaseClasslessCNAME(ip string) {
+	cname := re.Config.classlessCNAME(ip)
+	if cname == nil {
+		return
+	}
+	for _, rr := range re.M[re.Config.ptrZone(ip)] {
+		if rr.Header().Rrtype == dns.TypePTR && rr.Header().Name == cname.Target {
+			return
+		}
+	}
+	if zone := re.zoneOf(cname.Hdr.Name); zone != "" {
+		re.removeRR(zone, cname)
+	}
+}
+
+// moveClasslessCNAMEs publish CNAMEs of addresses in classless zones
+// under new reverse zone, which became their parent zone
+func (re *RamRecord) moveClasslessCNAMEs(zone string) {
+	for _, z := range re.Zones {
+		if z == zone || !dns.IsSubDomain(zone, z) || !strings.Contains(z, "/") {
+			continue
+		}
+		for _, rr := range re.M[z] {
+			if rr.Header().Rrtype != dns.TypePTR {
+				continue
+			}
+			cname := re.Config.classlessCNAME(ptrAddress(rr.Header().Name))
+			if cname == nil || re.zoneOf(cname.Hdr.Name) != zone {
+				continue
+			}
+			// CNAME could be published by the previous parent zone
+			for _, other := range re.Zones {
+				if other != zone {
+					re.removeRR(other, cname)
+				}
+			}
+			re.addRR(zone, cname)
+		}
+	}
+}
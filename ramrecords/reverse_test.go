@@ -0,0 +1,146 @@
+package ramrecords
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestReverseZone(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		want    string
+		wantErr bool
+	}{
+		{"10.0.0.0/8", "10.in-addr.arpa.", false},
+		{"10.0.0.0/16", "0.10.in-addr.arpa.", false},
+		{"10.0.0.0/24", "0.0.10.in-addr.arpa.", false},
+		{"192.0.2.64/26", "64/26.2.0.192.in-addr.arpa.", false},
+		{"192.0.2.5/32", "5/32.2.0.192.in-addr.arpa.", false},
+		{"10.16.0.0/12", "", true},
+		{"0.0.0.0/0", "", true},
+		{"2001:db8::/32", "8.b.d.0.1.0.0.2.ip6.arpa.", false},
+		{"2001:db8:a0::/44", "a.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", false},
+		{"2001:db8::/33", "", true},
+	}
+
+	for _, tt := range tests {
+		_, prefix, err := net.ParseCIDR(tt.prefix)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%s) error = %v", tt.prefix, err)
+		}
+		got, err := ReverseZone(prefix)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ReverseZone(%s) = %q, %v, want %q", tt.prefix, got, err, tt.want)
+		}
+	}
+}
+
+func TestReversePrefixes(t *testing.T) {
+	var prefixes []*net.IPNet
+	for _, p := range []string{"10.0.0.0/8", "10.1.0.0/16", "192.0.2.64/26", "2001:db8::/48"} {
+		_, prefix, _ := net.ParseCIDR(p)
+		prefixes = append(prefixes, prefix)
+	}
+	re, err := InitRamRecords(Config{
+		Default: ZoneConfig{NS: []NameServer{{Name: "ns1", IPv4: net.ParseIP("10.1.0.53")}}},
+		Reverse: prefixes,
+	})
+	if err != nil {
+		t.Fatalf("InitRamRecords() error = %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		zone string
+		ptr  string
+	}{
+		// Address with zero octets, broken by stripping "0."
+		{"10.0.0.5/24", "10.in-addr.arpa.", "5.0.0.10.in-addr.arpa."},
+		{"10.1.2.3/24", "1.10.in-addr.arpa.", "3.2.1.10.in-addr.arpa."},
+		{"192.0.2.70/26", "64/26.2.0.192.in-addr.arpa.", "70.64/26.2.0.192.in-addr.arpa."},
+		{"192.0.2.10/24", "2.0.192.in-addr.arpa.", "10.2.0.192.in-addr.arpa."},
+		{"2001:db8::1/64", "0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+		{"2001:db9::1/64", "9.b.d.0.1.0.0.2.ip6.arpa.", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.9.b.d.0.1.0.0.2.ip6.arpa."},
+	}
+
+	for _, tt := range tests {
+		family := int8(4)
+		if net.ParseIP(cutCIDRMask(tt.ip)).To4() == nil {
+			family = 6
+		}
+		re.AddAddress(family, tt.ip, "host.reverse.test.")
+
+		if got := recordsOf(re, tt.zone, tt.ptr, dns.TypePTR); len(got) != 1 {
+			t.Errorf("Expected PTR %s in zone %s, got %v", tt.ptr, tt.zone, got)
+		}
+
+		re.RemoveRecord(family, tt.ip, "host.reverse.test.")
+		if got := recordsOf(re, tt.zone, tt.ptr, dns.TypePTR); len(got) != 0 {
+			t.Errorf("Expected PTR %s removed, got %v", tt.ptr, got)
+		}
+	}
+
+	// Glue is published only in the zone of its prefix
+	if got := recordsOf(re, "1.10.in-addr.arpa.", "53.0.1.10.in-addr.arpa.", dns.TypePTR); len(got) != 1 {
+		t.Errorf("Expected glue PTR in 1.10.in-addr.arpa., got %v", got)
+	}
+	if got := recordsOf(re, "10.in-addr.arpa.", "53.0.1.10.in-addr.arpa.", dns.TypePTR); len(got) != 0 {
+		t.Errorf("Unexpected glue PTR in 10.in-addr.arpa., got %v", got)
+	}
+}
+
+func TestPtrAddress(t *testing.T) {
+	for _, ip := range []string{"10.0.0.5", "192.0.2.70", "2001:db8::1"} {
+		name, _ := dns.ReverseAddr(ip)
+		if got := ptrAddress(name); got != ip {
+			t.Errorf("ptrAddress(%s) = %q, want %q", name, got, ip)
+		}
+	}
+	if got := ptrAddress("70.64/26.2.0.192.in-addr.arpa."); got != "192.0.2.70" {
+		t.Errorf("ptrAddress() of classless name = %q", got)
+	}
+	if got := ptrAddress("2.0.192.in-addr.arpa."); got != "" {
+		t.Errorf("ptrAddress() of zone = %q", got)
+	}
+}
+
+func TestClasslessCNAME(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR("192.0.2.64/26")
+	re, _ := InitRamRecords(Config{Default: ZoneConfig{NS: []NameServer{{Name: "ns1"}}}, Reverse: []*net.IPNet{prefix}})
+
+	const (
+		parent = "2.0.192.in-addr.arpa."
+		owner  = "70.2.0.192.in-addr.arpa."
+	)
+
+	// Parent zone isn't served, CNAME is published by its owner
+	re.AddAddress(4, "192.0.2.70/26", "a.classless.test.")
+	if got := recordsOf(re, parent, owner, dns.TypeCNAME); len(got) != 0 {
+		t.Errorf("Unexpected CNAME without parent zone, got %v", got)
+	}
+
+	// Parent zone created later publish CNAME of existing address
+	re.AddAddress(4, "192.0.2.10/24", "b.classless.test.")
+	if got := recordsOf(re, parent, owner, dns.TypeCNAME); len(got) != 1 || got[0] != "70.64/26.2.0.192.in-addr.arpa." {
+		t.Errorf("Expected CNAME to classless zone, got %v", got)
+	}
+
+	// CNAME is kept while the address has other PTR
+	re.AddAddress(4, "192.0.2.70/26", "c.classless.test.")
+	re.RemoveRecord(4, "192.0.2.70/26", "a.classless.test.")
+	if got := recordsOf(re, parent, owner, dns.TypeCNAME); len(got) != 1 {
+		t.Errorf("Expected CNAME kept, got %v", got)
+	}
+	re.RemoveRecord(4, "192.0.2.70/26", "c.classless.test.")
+	if got := recordsOf(re, parent, owner, dns.TypeCNAME); len(got) != 0 {
+		t.Errorf("Expected CNAME removed with the last PTR, got %v", got)
+	}
+
+	// New address in served parent zone gets CNAME right away
+	re.AddAddress(4, "192.0.2.71/26", "d.classless.test.")
+	if got := recordsOf(re, parent, "71.2.0.192.in-addr.arpa.", dns.TypeCNAME); len(got) != 1 {
+		t.Errorf("Expected CNAME of new address, got %v", got)
+	}
+}
@@ -0,0 +1,61 @@
+package ramrecords
+
+import (
+	"time"
+)
+
+// Policies used to generate SOA serial
+const (
+	SerialUnixTime  = "unixtime"   // Seconds since epoch
+	SerialDate      = "dateserial" // YYYYMMDDnn
+	SerialIncrement = "increment"  // Seeded by the time, then 1 by 1
+)
+
+// now is used to get current time, can be replaced in tests
+var now = time.Now
+
+// initialSerial returns serial of newly created zone. Zone created again
+// after restart without snapshot must not go back behind the serial
+// known to secondaries, so the serial is derived from the time.
+func (c Config) initialSerial() uint32 {
+	t := now().UTC()
+
+	switch c.Serial {
+	case SerialUnixTime, SerialIncrement:
+		return uint32(t.Unix())
+	default:
+		// Part of the day elapsed, one step per 864 seconds
+		day := t.Sub(t.Truncate(24 * time.Hour))
+		return dateSerial(t) + uint32(day/(864*time.Second))
+	}
+}
+
+// nextSerial returns serial following old one, the result is
+// always newer than old in the sense of RFC 1982 serial arithmetic.
+// Serial 0 is skipped on wrap around, it is used to request AXFR.
+func (c Config) nextSerial(old uint32) uint32 {
+	t := now().UTC()
+
+	var serial uint32
+	switch c.Serial {
+	case SerialUnixTime:
+		serial = uint32(t.Unix())
+	case SerialIncrement:
+		serial = old + 1
+	default:
+		serial = dateSerial(t)
+	}
+
+	if int32(serial-old) <= 0 {
+		serial = old + 1
+	}
+	if serial == 0 {
+		serial = 1
+	}
+	return serial
+}
+
+// dateSerial returns first serial of the day in YYYYMMDDnn format
+func dateSerial(t time.Time) uint32 {
+	return uint32(t.Year()*1000000 + int(t.Month())*10000 + t.Day()*100)
+}
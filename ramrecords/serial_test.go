@@ -0,0 +1,83 @@
+package ramrecords
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSerialPolicy(t *testing.T) {
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC) }
+
+	unix := uint32(now().Unix())
+
+	tests := []struct {
+		name    string
+		policy  string
+		old     uint32
+		initial uint32
+		next    uint32
+	}{
+		{name: "Date first change of the day", policy: SerialDate, old: 2022030399, initial: 2022030421, next: 2022030400},
+		{name: "Date next change of the day", policy: SerialDate, old: 2022030400, initial: 2022030421, next: 2022030401},
+		{name: "Default is date", policy: "", old: 2022030405, initial: 2022030421, next: 2022030406},
+		{name: "Unix time", policy: SerialUnixTime, old: unix - 10, initial: unix, next: unix},
+		{name: "Unix time changed in the same second", policy: SerialUnixTime, old: unix, initial: unix, next: unix + 1},
+		{name: "Increment", policy: SerialIncrement, old: 41, initial: unix, next: 42},
+		{name: "Increment wraps around without 0", policy: SerialIncrement, old: 4294967295, initial: unix, next: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Serial: tt.policy}
+			if got := c.initialSerial(); got != tt.initial {
+				t.Errorf("initialSerial() = %d, want %d", got, tt.initial)
+			}
+			if got := c.nextSerial(tt.old); got != tt.next {
+				t.Errorf("nextSerial(%d) = %d, want %d", tt.old, got, tt.next)
+			}
+		})
+	}
+}
+
+func TestSerialBump(t *testing.T) {
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC) }
+
+	re, _ := InitRamRecords(Config{Serial: SerialIncrement})
+
+	serial := func(zone string) uint32 {
+		for _, rr := range re.Snapshot().M[zone] {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return soa.Serial
+			}
+		}
+		t.Fatalf("Missing SOA in zone %s", zone)
+		return 0
+	}
+
+	// Increment is seeded by the time, to not go back after restart
+	re.AddZone("a.serial.test.")
+	re.AddPTRZone(4, "10.8.8.1/24", "a.serial.test.")
+	initial := uint32(now().Unix())
+	if serial("serial.test.") != initial || serial("8.8.10.in-addr.arpa.") != initial {
+		t.Fatalf("Expected initial serial %d, got %d, %d", initial, serial("serial.test."), serial("8.8.10.in-addr.arpa."))
+	}
+
+	re.AddRecord(4, "10.8.8.1/24", "a.serial.test.")
+	re.UpdateRecord(4, "10.8.8.1/24", "b.serial.test.")
+	re.RemoveRecord(4, "10.8.8.1/24", "b.serial.test.")
+
+	// Forward and reverse zone are changed by every call
+	if serial("serial.test.") != initial+3 || serial("8.8.10.in-addr.arpa.") != initial+3 {
+		t.Errorf("Expected serial %d, got %d, %d", initial+3, serial("serial.test."), serial("8.8.10.in-addr.arpa."))
+	}
+
+	// Nothing changed, serial stays
+	re.RemoveRecord(4, "10.8.8.1/24", "b.serial.test.")
+	if serial("serial.test.") != initial+3 {
+		t.Errorf("Expected serial %d, got %d", initial+3, serial("serial.test."))
+	}
+}
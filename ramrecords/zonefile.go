@@ -0,0 +1,104 @@
+package ramrecords
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ErrUnknownZone is returned when zone isn't in RamRecord
+var ErrUnknownZone = errors.New("unknown zone")
+
+// WriteZone write zone as RFC 1035 master file,
+// SOA is written first and other records are sorted
+func (re *RamRecord) WriteZone(w io.Writer, zone string) error {
+	zone = strings.ToLower(dns.Fqdn(zone))
+
+	records, ok := re.Snapshot().M[zone]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownZone, zone)
+	}
+
+	return writeZone(w, zone, records)
+}
+
+// WriteZones write all zones as RFC 1035 master files, zones are sorted
+func (re *RamRecord) WriteZones(w io.Writer) error {
+	snap := re.Snapshot()
+
+	zones := make([]string, 0, len(snap.M))
+	for zone := range snap.M {
+		zones = append(zones, zone)
+	}
+	sort.Slice(zones, func(i, j int) bool { return canonicalLess(zones[i], zones[j]) })
+
+	for i, zone := range zones {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := writeZone(w, zone, snap.M[zone]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeZone write single zone with $ORIGIN and SOA on the top
+func writeZone(w io.Writer, zone string, records []dns.RR) error {
+	var soa dns.RR
+	rrs := make([]dns.RR, 0, len(records))
+	for _, rr := range records {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			if soa == nil {
+				soa = rr
+			}
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	if soa == nil {
+		return fmt.Errorf("zone %s has no SOA record", zone)
+	}
+
+	sort.SliceStable(rrs, func(i, j int) bool {
+		a, b := rrs[i].Header(), rrs[j].Header()
+		if a.Name != b.Name {
+			return canonicalLess(a.Name, b.Name)
+		}
+		if a.Rrtype != b.Rrtype {
+			return a.Rrtype < b.Rrtype
+		}
+		return rrs[i].String() < rrs[j].String()
+	})
+
+	if _, err := fmt.Fprintf(w, "$ORIGIN %s\n%s\n", zone, soa); err != nil {
+		return err
+	}
+	for _, rr := range rrs {
+		if _, err := fmt.Fprintln(w, rr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// canonicalLess compare names in RFC 4034 canonical order,
+// labels are compared from the most significant one
+func canonicalLess(a, b string) bool {
+	la, lb := dns.SplitDomainName(strings.ToLower(a)), dns.SplitDomainName(strings.ToLower(b))
+
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if la[i] != lb[j] {
+			return la[i] < lb[j]
+		}
+	}
+	return len(la) < len(lb)
+}
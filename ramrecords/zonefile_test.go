@@ -0,0 +1,107 @@
+package ramrecords
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/miekg/dns"
+)
+
+// zoneFileConfig serves zonefile.test. with glue of its name server
+var zoneFileConfig = Config{
+	Default: ZoneConfig{
+		NS: []NameServer{{Name: "ns1", IPv4: net.ParseIP("10.12.12.53")}},
+	},
+}
+
+// zoneFileAddresses are added out of order, zone files are sorted
+var zoneFileAddresses = []testAddress{
+	{4, "10.12.12.3/24", "zz.zonefile.test."},
+	{4, "10.12.12.1/24", "a.zonefile.test."},
+	{4, "10.12.12.2/24", "b.zonefile.test."},
+}
+
+func TestWriteZone(t *testing.T) {
+	re := newTestRecords(t, zoneFileConfig, zoneFileAddresses...)
+
+	var buf bytes.Buffer
+	if err := re.WriteZone(&buf, "zonefile.test"); err != nil {
+		t.Fatalf("WriteZone() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != "$ORIGIN zonefile.test." {
+		t.Errorf("Expected $ORIGIN on the first line, got %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "\tSOA\t") {
+		t.Errorf("Expected SOA on the second line, got %q", lines[1])
+	}
+
+	// Records are sorted in canonical order
+	var names []string
+	for _, l := range lines[2:] {
+		names = append(names, strings.Fields(l)[0]+" "+strings.Fields(l)[3])
+	}
+	want := []string{
+		"zonefile.test. NS",
+		"a.zonefile.test. A",
+		"b.zonefile.test. A",
+		"ns1.zonefile.test. A",
+		"zz.zonefile.test. A",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected records %v, got %v", want, names)
+	}
+
+	// Output is loadable by CoreDNS file plugin
+	z, err := file.Parse(strings.NewReader(buf.String()), "zonefile.test.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("file.Parse() error = %v", err)
+	}
+	if z.Apex.SOA == nil || len(z.Apex.NS) != 1 {
+		t.Errorf("Expected SOA and NS in parsed zone, got %v", z.Apex)
+	}
+}
+
+func TestWriteZones(t *testing.T) {
+	re := newTestRecords(t, zoneFileConfig, zoneFileAddresses...)
+
+	var buf bytes.Buffer
+	if err := re.WriteZones(&buf); err != nil {
+		t.Fatalf("WriteZones() error = %v", err)
+	}
+
+	// Every zone is loadable on its own
+	zones := strings.Split(buf.String(), "\n\n")
+	if len(zones) != 2 {
+		t.Fatalf("Expected 2 zones, got %d", len(zones))
+	}
+	for i, origin := range []string{"12.12.10.in-addr.arpa.", "zonefile.test."} {
+		zp := dns.NewZoneParser(strings.NewReader(zones[i]), "", "")
+		var count int
+		for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+			if !dns.IsSubDomain(origin, rr.Header().Name) {
+				t.Errorf("Record %s is out of zone %s", rr, origin)
+			}
+			count++
+		}
+		if err := zp.Err(); err != nil {
+			t.Errorf("Unable parse zone %s error = %v", origin, err)
+		}
+		if count == 0 {
+			t.Errorf("No records in zone %s", origin)
+		}
+	}
+}
+
+func TestWriteUnknownZone(t *testing.T) {
+	re := newTestRecords(t, zoneFileConfig, zoneFileAddresses...)
+
+	if err := re.WriteZone(&bytes.Buffer{}, "unknown.test."); !errors.Is(err, ErrUnknownZone) {
+		t.Errorf("Expected ErrUnknownZone, got %v", err)
+	}
+}
@@ -1,5 +1,120 @@
 package nautobotor
 
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
 // Ready implements the ready.Readiness interface, once this flips to true CoreDNS
 // assumes this plugin is ready for queries; it is not checked again.
-func (e Nautobotor) Ready() bool { return true }
+// Plugin is ready after first full sync with nautobot, or when snapshot was loaded.
+func (e Nautobotor) Ready() bool { return e.status.isReady() }
+
+// syncStatus tracks synchronization with nautobot,
+// it is shared by all copies of the plugin
+type syncStatus struct {
+	mu          sync.RWMutex
+	ready       bool
+	lastSync    time.Time
+	lastError   error
+	lastWebhook time.Time
+}
+
+// synced mark successful full sync with nautobot
+func (s *syncStatus) synced() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ready = true
+	s.lastSync = time.Now()
+	s.lastError = nil
+}
+
+// failed note error of the sync with nautobot
+func (s *syncStatus) failed(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastError = err
+}
+
+// snapshotLoaded mark plugin ready, records are served from the snapshot
+func (s *syncStatus) snapshotLoaded() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ready = true
+}
+
+// webhookReceived note time of the last webhook
+func (s *syncStatus) webhookReceived() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastWebhook = time.Now()
+}
+
+// isReady report if plugin has data to serve
+func (s *syncStatus) isReady() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ready
+}
+
+// health is JSON response of the health endpoint
+type health struct {
+	Ready            bool     `json:"ready"`
+	LastSync         string   `json:"last_sync,omitempty"`
+	LastError        string   `json:"last_error,omitempty"`
+	SinceLastWebhook *float64 `json:"since_last_webhook_seconds,omitempty"`
+}
+
+// handleHealth report state of the sync with nautobot,
+// 503 is returned until plugin is ready
+func (n *Nautobotor) handleHealth(w http.ResponseWriter, r *http.Request) {
+	var h health
+	if s := n.status; s != nil {
+		s.mu.RLock()
+		h.Ready = s.ready
+		if !s.lastSync.IsZero() {
+			h.LastSync = s.lastSync.UTC().Format(time.RFC3339)
+		}
+		if s.lastError != nil {
+			h.LastError = s.lastError.Error()
+		}
+		if !s.lastWebhook.IsZero() {
+			since := time.Since(s.lastWebhook).Seconds()
+			h.SinceLastWebhook = &since
+		}
+		s.mu.RUnlock()
+	}
+
+	code := http.StatusOK
+	if !h.Ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		log.Errorf("error writing health response: err=%s\n", err)
+	}
+}
@@ -0,0 +1,80 @@
+package nautobotor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jakubjastrabik/nautobotor/nautobot"
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+)
+
+func getHealth(t *testing.T, n *Nautobotor) (int, health) {
+	w := httptest.NewRecorder()
+	n.handleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var h health
+	if err := json.Unmarshal(w.Body.Bytes(), &h); err != nil {
+		t.Fatalf("Unable unmarshal health response error = %s", err)
+	}
+	return w.Code, h
+}
+
+func TestReady(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer down.Close()
+	up := newNautobotServer(t, []nautobot.Results{
+		{Family: nautobot.Family{Value: 4}, Address: "10.14.14.1/24", Dns_name: "a.ready.test."},
+	}, 50)
+	defer up.Close()
+
+	n := Nautobotor{
+		NautobotURL: down.URL,
+		RM:          ramrecords.New(),
+		status:      new(syncStatus),
+		client:      newTestClient(t),
+	}
+
+	// Failed sync, plugin isn't ready
+	if err := n.getApiData(); err == nil {
+		t.Fatal("Expected error from unavailable nautobot")
+	}
+	if n.Ready() {
+		t.Error("Expected plugin not ready before first sync")
+	}
+	code, h := getHealth(t, &n)
+	if code != http.StatusServiceUnavailable || h.Ready || h.LastError == "" || h.LastSync != "" {
+		t.Errorf("Unexpected health before sync, got %d %+v", code, h)
+	}
+
+	// Successful sync
+	n.NautobotURL = up.URL
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+	if !n.Ready() {
+		t.Error("Expected plugin ready after first sync")
+	}
+	code, h = getHealth(t, &n)
+	if code != http.StatusOK || !h.Ready || h.LastError != "" || h.LastSync == "" || h.SinceLastWebhook != nil {
+		t.Errorf("Unexpected health after sync, got %d %+v", code, h)
+	}
+
+	// Webhook received
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"event": "deleted", "data": {"family": {"value": 4}, "address": "10.14.14.1/24", "dns_name": "a.ready.test."}}`))
+	n.handleWebhook(httptest.NewRecorder(), req)
+	if _, h = getHealth(t, &n); h.SinceLastWebhook == nil {
+		t.Errorf("Expected time since last webhook, got %+v", h)
+	}
+
+	// Later failure keeps plugin ready, but is reported
+	n.NautobotURL = down.URL
+	n.resync()
+	if code, h = getHealth(t, &n); code != http.StatusOK || h.LastError == "" {
+		t.Errorf("Expected last error after failed resync, got %d %+v", code, h)
+	}
+}
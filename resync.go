@@ -0,0 +1,250 @@
+package nautobotor
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jakubjastrabik/nautobotor/nautobot"
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+	"github.com/miekg/dns"
+)
+
+// syncRetryInterval is delay between attempts to load data from nautobot,
+// when plugin was started from the snapshot
+var syncRetryInterval = 30 * time.Second
+
+// initialSync load snapshot, if configured, and then data from nautobot.
+// When nautobot isn't available, plugin serve the snapshot and retry in the background.
+func (n *Nautobotor) initialSync() error {
+	warm := false
+	if n.persister != nil {
+		if err := n.persister.load(n.RM); err != nil {
+			log.Warningf("Unable load snapshot: err=%s\n", err)
+		} else {
+			log.Infof("Loaded snapshot from %s", n.persister.path)
+			n.status.snapshotLoaded()
+			// Snapshot is loaded without change hooks
+			updateZoneMetrics(n.RM, n.RM.Snapshot().Zones)
+			warm = true
+		}
+	}
+
+	err := n.getApiData()
+	if err == nil || !warm {
+		return err
+	}
+
+	log.Warningf("Nautobot unavailable, serving snapshot until it answers: err=%s\n", err)
+	go n.retrySync(n.stop)
+
+	return nil
+}
+
+// retrySync try to load data from nautobot until it succeed
+func (n *Nautobotor) retrySync(stop chan struct{}) {
+	ticker := time.NewTicker(syncRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := n.getApiData(); err != nil {
+				log.Warningf("Nautobot still unavailable: err=%s\n", err)
+				continue
+			}
+			return
+		}
+	}
+}
+
+// startResync periodically reload all IP addresses from nautobot
+// and reconcile them with RamRecord
+func (n *Nautobotor) startResync() {
+	if n.Resync <= 0 {
+		return
+	}
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(n.Resync)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := n.resync(); err != nil {
+					log.Errorf("Unable resync data from nautobot: err=%s\n", err)
+				}
+			}
+		}
+	}(n.stop)
+}
+
+// shutdown stop web server and all background tasks,
+// reloaded instance must not receive webhooks anymore
+func (n *Nautobotor) shutdown() {
+	// Listener and open connections are closed
+	if n.server != nil {
+		if err := n.server.Close(); err != nil {
+			log.Errorf("error closing web server: err=%s\n", err)
+		}
+	}
+	if n.stop == nil {
+		return
+	}
+	select {
+	case <-n.stop:
+	default:
+		close(n.stop)
+	}
+}
+
+// resync fetch full IP set from nautobot and apply only the differences
+func (n *Nautobotor) resync() error {
+	log.Debug("Start resync with nautobot")
+	start := time.Now()
+	defer func() { syncDuration.Observe(time.Since(start).Seconds()) }()
+
+	ip, err := n.fetchAPIData()
+	if err != nil {
+		n.status.failed(err)
+		return err
+	}
+
+	added, removed, changed := n.reconcile(ip.Results)
+	n.status.synced()
+	lastSync.SetToCurrentTime()
+	log.Infof("Resync with nautobot done: added=%d, removed=%d, changed=%d", added, removed, changed)
+
+	return nil
+}
+
+// reconcile diff nautobot results against the RamRecord
+// adds missing, removes stale and changes renamed records
+func (n *Nautobotor) reconcile(results []nautobot.Results) (added, removed, changed int) {
+	// Desired state, keyed by IP address and FQDN
+	want := make(map[string]map[string]nautobot.Results)
+	for _, r := range results {
+		ip := addressIP(r.Address)
+		if ip == "" || r.Dns_name == "" || !n.published(r.Status.Value) {
+			continue
+		}
+		// REST API results are filtered by nautobot, GraphQL queries aren't
+		if n.GraphQLQuery != "" && !n.Filter.MatchResults(r) {
+			continue
+		}
+		if _, err := n.RM.ZoneFor(r.Dns_name); err != nil {
+			log.Warningf("Skip address %s: err=%s\n", r.Address, err)
+			continue
+		}
+		if want[ip] == nil {
+			want[ip] = make(map[string]nautobot.Results)
+		}
+		want[ip][strings.ToLower(dns.Fqdn(r.Dns_name))] = r
+	}
+
+	// Whole diff is published by a single update, serials are bumped once
+	n.RM.Batch(func(tx *ramrecords.Tx) error {
+		added, removed, changed = n.applyDiff(tx, want)
+		return nil
+	})
+
+	resyncCount.WithLabelValues("add").Add(float64(added))
+	resyncCount.WithLabelValues("remove").Add(float64(removed))
+	resyncCount.WithLabelValues("change").Add(float64(changed))
+
+	return added, removed, changed
+}
+
+// applyDiff change the zones to the desired state, keyed by IP address and FQDN
+func (n *Nautobotor) applyDiff(tx *ramrecords.Tx, want map[string]map[string]nautobot.Results) (added, removed, changed int) {
+	// Current state, keyed by IP address and FQDN
+	have := make(map[string]map[string]ramrecords.Address)
+	for _, a := range tx.Addresses() {
+		if have[a.Address] == nil {
+			have[a.Address] = make(map[string]ramrecords.Address)
+		}
+		have[a.Address][a.DnsName] = a
+	}
+
+	for ip, names := range want {
+		var adds []nautobot.Results
+		for name, r := range names {
+			if _, ok := have[ip][name]; !ok {
+				adds = append(adds, r)
+			}
+		}
+
+		var removes []ramrecords.Address
+		for name, a := range have[ip] {
+			if _, ok := names[name]; !ok && !a.Glue {
+				removes = append(removes, a)
+			}
+		}
+
+		// Address with stale name and new name is a rename
+		for len(adds) > 0 && len(removes) > 0 {
+			a, r := removes[0], adds[0]
+			tx.RemoveAddress(a.Family, a.Address, a.DnsName)
+			tx.AddAddress(r.Family.Value, r.Address, r.Dns_name)
+			adds, removes = adds[1:], removes[1:]
+			changed++
+		}
+		for _, r := range adds {
+			tx.AddAddress(r.Family.Value, r.Address, r.Dns_name)
+			added++
+		}
+		for _, a := range removes {
+			tx.RemoveAddress(a.Family, a.Address, a.DnsName)
+			removed++
+		}
+	}
+
+	// Addresses which are no longer in nautobot
+	for ip, names := range have {
+		if _, ok := want[ip]; ok {
+			continue
+		}
+		for _, a := range names {
+			if a.Glue {
+				continue
+			}
+			tx.RemoveAddress(a.Family, a.Address, a.DnsName)
+			removed++
+		}
+	}
+
+	// Custom records of all addresses of the name
+	data := make(map[string]map[string]ramrecords.RecordData)
+	for ip, names := range want {
+		for name, r := range names {
+			if data[name] == nil {
+				data[name] = make(map[string]ramrecords.RecordData)
+			}
+			data[name][ip] = ramrecords.RecordData{CustomFields: r.Custom_fields, Tags: r.Tags.Names()}
+		}
+	}
+	for name, d := range data {
+		// Counts are of addresses, custom records aren't included
+		if err := tx.SetNameData(name, d); err != nil {
+			log.Warningf("Invalid custom records of %s: err=%s\n", name, err)
+		}
+	}
+
+	return added, removed, changed
+}
+
+// addressIP return IP address without CIDRMask
+func addressIP(address string) string {
+	ip, _, err := net.ParseCIDR(address)
+	if err != nil {
+		if ip = net.ParseIP(address); ip == nil {
+			return ""
+		}
+	}
+	return ip.String()
+}
@@ -2,16 +2,54 @@ package nautobotor
 
 import (
 	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/jakubjastrabik/nautobotor/nautobot"
 	"github.com/jakubjastrabik/nautobotor/ramrecords"
+	"github.com/miekg/dns"
 )
 
 var Version = "v0.50.6"
 
+// userAgent returns User-Agent sent to nautobot
+func userAgent() string { return "nautobotor/" + Version }
+
+// defaultJournal is number of changes kept per zone for IXFR
+const defaultJournal = 100
+
+// SOA names used before SOA was configurable
+const (
+	legacyMname = "ns"
+	legacyRname = "noc-srv.lastmile.sk."
+)
+
+// legacyNameServers returns name servers used before they were configurable,
+// Corefile without nameserver keeps working with them
+func legacyNameServers() []ramrecords.NameServer {
+	return []ramrecords.NameServer{
+		{Name: "ans-m1", IPv4: net.ParseIP("172.16.5.90")},
+		{Name: "arn-t1", IPv4: net.ParseIP("172.16.5.76")},
+		{Name: "arn-x1", IPv4: net.ParseIP("172.16.5.77")},
+	}
+}
+
+// defaultStatus is nautobot status of published addresses,
+// when statuses aren't configured
+const defaultStatus = "active"
+
 // init registers this plugin.
 func init() { plugin.Register("nautobotor", setup) }
 
@@ -38,20 +76,60 @@ func setup(c *caddy.Controller) error {
 			}
 			if x, ok := m.(*metrics.Metrics); ok {
 				x.MustRegister(requestCount)
+				x.MustRegister(resyncCount)
+				x.MustRegister(webhookAuthFailures)
+				x.MustRegister(invalidAddresses)
+				x.MustRegister(queryCount)
+				x.MustRegister(nxdomainCount)
+				x.MustRegister(nodataCount)
+				x.MustRegister(zonesCount)
+				x.MustRegister(recordsCount)
+				x.MustRegister(webhookCount)
+				x.MustRegister(syncDuration)
+				x.MustRegister(lastSync)
 			}
 		})
 		return nil
 	})
 
+	// Keep zone and record metrics in sync with changes of the zones
 	c.OnStartup(func() error {
-		err := nautobotorPlugin.getApiData()
+		rm := nautobotorPlugin.RM
+		rm.OnChange(func(zones []string) { updateZoneMetrics(rm, zones) })
+		return nil
+	})
+
+	if nautobotorPlugin.notifier != nil {
+		c.OnStartup(func() error {
+			nautobotorPlugin.notifier.start(nautobotorPlugin.RM)
+			return nil
+		})
+		c.OnShutdown(func() error {
+			nautobotorPlugin.notifier.shutdown()
+			return nil
+		})
+	}
+
+	c.OnStartup(func() error {
+		err := nautobotorPlugin.initialSync()
 		if err != nil {
-			log.Errorf("Unable startup web server: err=%s\n", err)
+			log.Errorf("Unable load data from nautobot: err=%s\n", err)
 			return err
 		}
 		return nil
 	})
 
+	if nautobotorPlugin.persister != nil {
+		c.OnStartup(func() error {
+			nautobotorPlugin.persister.start(nautobotorPlugin.RM)
+			return nil
+		})
+		c.OnShutdown(func() error {
+			nautobotorPlugin.persister.shutdown()
+			return nil
+		})
+	}
+
 	c.OnStartup(func() error {
 		err := nautobotorPlugin.onStartup()
 		if err != nil {
@@ -61,6 +139,16 @@ func setup(c *caddy.Controller) error {
 		return nil
 	})
 
+	c.OnStartup(func() error {
+		nautobotorPlugin.startResync()
+		return nil
+	})
+
+	c.OnShutdown(func() error {
+		nautobotorPlugin.shutdown()
+		return nil
+	})
+
 	// Add the Plugin to CoreDNS, so Servers can use it in their plugin chain.
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		return nautobotorPlugin
@@ -71,52 +159,450 @@ func setup(c *caddy.Controller) error {
 }
 
 func newNautobotor(c *caddy.Controller) (Nautobotor, error) {
-	var n = Nautobotor{}
+	var n = Nautobotor{
+		stop:     make(chan struct{}),
+		status:   new(syncStatus),
+		Statuses: map[string]bool{defaultStatus: true},
+	}
+	var cfg = ramrecords.Config{
+		Zones:   make(map[string]ramrecords.ZoneConfig),
+		Journal: defaultJournal,
+	}
+	var clientCfg = nautobot.ClientConfig{UserAgent: userAgent()}
 
 	for c.Next() {
-		if c.NextBlock() {
-			for {
-				switch c.Val() {
-				case "webaddress":
-					if !c.NextArg() {
-						log.Error(c.ArgErr())
+		if len(c.RemainingArgs()) != 0 {
+			return Nautobotor{}, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "webaddress":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				if _, _, err := net.SplitHostPort(v); err != nil {
+					return Nautobotor{}, c.Errf("invalid webaddress '%s': %s", v, err)
+				}
+				n.WebAddress = v
+
+			case "nautoboturl":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				u, err := url.Parse(v)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return Nautobotor{}, c.Errf("invalid nautoboturl '%s'", v)
+				}
+				n.NautobotURL = v
+
+			case "graphql":
+				// graphql [v1|v2|QUERY_FILE]
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return Nautobotor{}, c.ArgErr()
+				}
+				n.GraphQLQuery = nautobot.DefaultGraphQLQuery
+				if len(args) == 1 {
+					if q, ok := nautobot.GraphQLQueries[strings.ToLower(args[0])]; ok {
+						n.GraphQLQuery = q
+						break
 					}
-					n.WebAddress = c.Val()
-				case "nautoboturl":
-					if !c.NextArg() {
-						log.Error(c.ArgErr())
+					q, err := ioutil.ReadFile(args[0])
+					if err != nil {
+						return Nautobotor{}, c.Errf("unable read graphql query: %s", err)
 					}
-					n.NautobotURL = c.Val()
+					n.GraphQLQuery = string(q)
+				}
+
+			case "graphql_url":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				u, err := url.Parse(v)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return Nautobotor{}, c.Errf("invalid graphql_url '%s'", v)
+				}
+				n.GraphQLURL = v
+
+			case "token":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				n.Token = v
+
+			case "timeout":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					return Nautobotor{}, c.Errf("invalid timeout '%s'", v)
+				}
+				clientCfg.Timeout = d
 
-				case "token":
-					if !c.NextArg() {
-						log.Error(c.ArgErr())
+			case "retries":
+				// retries COUNT [BACKOFF]
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return Nautobotor{}, c.ArgErr()
+				}
+				r, err := strconv.Atoi(args[0])
+				if err != nil || r < 0 {
+					return Nautobotor{}, c.Errf("invalid retries '%s'", args[0])
+				}
+				clientCfg.Retries = r
+				if r == 0 {
+					clientCfg.Retries = -1
+				}
+				if len(args) == 2 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil || d <= 0 {
+						return Nautobotor{}, c.Errf("invalid retry backoff '%s'", args[1])
 					}
-					n.Token = c.Val()
+					clientCfg.Backoff = d
+				}
+
+			case "ca_cert":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				clientCfg.CAFile = v
+
+			case "client_cert":
+				// client_cert CERT_FILE KEY_FILE
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return Nautobotor{}, c.ArgErr()
 				}
+				clientCfg.CertFile, clientCfg.KeyFile = args[0], args[1]
 
-				if !c.Next() {
-					break
+			case "proxy":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				clientCfg.Proxy = v
+
+			case "webhook_secret":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				n.WebhookSecret = v
+
+			case "resync":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					return Nautobotor{}, c.Errf("invalid resync interval '%s'", v)
+				}
+				n.Resync = d
+
+			case "journal":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				j, err := strconv.Atoi(v)
+				if err != nil || j < 0 {
+					return Nautobotor{}, c.Errf("invalid journal size '%s'", v)
+				}
+				cfg.Journal = j
+
+			case "serial":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				switch v {
+				case ramrecords.SerialUnixTime, ramrecords.SerialDate, ramrecords.SerialIncrement:
+					cfg.Serial = v
+				default:
+					return Nautobotor{}, c.Errf("unknown serial policy '%s'", v)
+				}
+
+			case "statuses":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return Nautobotor{}, c.ArgErr()
+				}
+				n.Statuses = make(map[string]bool, len(args))
+				for _, a := range args {
+					n.Statuses[strings.ToLower(a)] = true
+				}
+
+			case "filter":
+				// filter tag|tenant|vrf|namespace|role|parent VALUE...
+				args := c.RemainingArgs()
+				if len(args) < 2 {
+					return Nautobotor{}, c.ArgErr()
+				}
+				key := strings.ToLower(args[0])
+				if !nautobot.FilterKeys[key] {
+					return Nautobotor{}, c.Errf("unknown filter '%s'", args[0])
+				}
+				if n.Filter == nil {
+					n.Filter = make(nautobot.Filter)
 				}
+				n.Filter.Add(key, args[1:]...)
+
+			case "zones":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return Nautobotor{}, c.ArgErr()
+				}
+				for _, a := range args {
+					zone := strings.ToLower(dns.Fqdn(a))
+					if _, ok := dns.IsDomainName(zone); !ok {
+						return Nautobotor{}, c.Errf("invalid zone '%s'", a)
+					}
+					cfg.Authoritative = append(cfg.Authoritative, zone)
+				}
+
+			case "reverse":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return Nautobotor{}, c.ArgErr()
+				}
+				for _, a := range args {
+					_, prefix, err := net.ParseCIDR(a)
+					if err != nil {
+						return Nautobotor{}, c.Errf("invalid reverse prefix '%s'", a)
+					}
+					if _, err := ramrecords.ReverseZone(prefix); err != nil {
+						return Nautobotor{}, c.Errf("invalid reverse prefix '%s': %s", a, err)
+					}
+					cfg.Reverse = append(cfg.Reverse, prefix)
+				}
+
+			case "record":
+				// record TYPE custom_field NAME
+				// record TYPE tag PREFIX
+				args := c.RemainingArgs()
+				if len(args) != 3 {
+					return Nautobotor{}, c.ArgErr()
+				}
+				src := ramrecords.RecordSource{Type: dns.StringToType[strings.ToUpper(args[0])]}
+				switch src.Type {
+				case dns.TypeCNAME, dns.TypeMX, dns.TypeSRV, dns.TypeTXT:
+				default:
+					return Nautobotor{}, c.Errf("unsupported record type '%s'", args[0])
+				}
+				switch args[1] {
+				case "custom_field":
+					src.CustomField = args[2]
+				case "tag":
+					src.TagPrefix = args[2]
+				default:
+					return Nautobotor{}, c.Errf("unknown record source '%s'", args[1])
+				}
+				cfg.Records = append(cfg.Records, src)
+
+			case "notify":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return Nautobotor{}, c.ArgErr()
+				}
+				var to []string
+				for _, a := range args {
+					addr, err := parse.HostPort(a, transport.Port)
+					if err != nil {
+						return Nautobotor{}, c.Errf("invalid notify address '%s': %s", a, err)
+					}
+					to = append(to, addr)
+				}
+				n.notifier = newNotifier(to)
+
+			case "zone_export":
+				// zone_export TOKEN [CIDR...]
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return Nautobotor{}, c.ArgErr()
+				}
+				n.ExportToken = args[0]
+				for _, a := range args[1:] {
+					_, ipnet, err := net.ParseCIDR(a)
+					if err != nil {
+						return Nautobotor{}, c.Errf("invalid zone_export network '%s'", a)
+					}
+					n.ExportAllow = append(n.ExportAllow, ipnet)
+				}
+
+			case "snapshot":
+				v, err := singleArg(c)
+				if err != nil {
+					return Nautobotor{}, err
+				}
+				if fi, err := os.Stat(filepath.Dir(v)); err != nil || !fi.IsDir() {
+					return Nautobotor{}, c.Errf("invalid snapshot path '%s': directory doesn't exist", v)
+				}
+				n.persister = newPersister(v)
+
+			case "nameserver", "soa", "soa_timers":
+				if err := parseZoneConfig(c, &cfg.Default); err != nil {
+					return Nautobotor{}, err
+				}
+
+			case "zone":
+				if err := parseZoneBlock(c, &cfg); err != nil {
+					return Nautobotor{}, err
+				}
+
+			default:
+				return Nautobotor{}, c.Errf("unknown property '%s'", c.Val())
 			}
 		}
 	}
+
 	if n.WebAddress == "" {
-		return Nautobotor{}, errors.New("Could not parse config")
+		return Nautobotor{}, errors.New("webaddress is required")
+	}
+	if n.NautobotURL == "" {
+		return Nautobotor{}, errors.New("nautoboturl is required")
+	}
+	if len(cfg.Default.NS) == 0 {
+		log.Warningf("nameserver isn't configured, built-in name servers are deprecated and will be removed, add nameserver to the Corefile")
+		cfg.Default.NS = legacyNameServers()
+		if cfg.Default.SOA.Mname == "" && cfg.Default.SOA.Rname == "" {
+			cfg.Default.SOA.Mname, cfg.Default.SOA.Rname = legacyMname, legacyRname
+		}
+	}
+	if n.GraphQLQuery != "" && n.GraphQLURL == "" {
+		var err error
+		if n.GraphQLURL, err = graphQLURL(n.NautobotURL); err != nil {
+			return Nautobotor{}, err
+		}
 	}
 
-	// Init RamRecord
-	var err error
-	n.RM, err = ramrecords.InitRamRecords()
+	// Init nautobot API client
+	clientCfg.Token = n.Token
+	client, err := nautobot.NewClient(clientCfg)
 	if err != nil {
-		log.Error(err)
+		return Nautobotor{}, c.Errf("invalid nautobot client options: %s", err)
 	}
+	n.client = client
 
-	n.NS = map[string]string{
-		"ans-m1": "172.16.5.90/24",
-		"arn-t1": "172.16.5.76/24",
-		"arn-x1": "172.16.5.77/24",
+	// Init RamRecord
+	n.RM, err = ramrecords.InitRamRecords(cfg)
+	if err != nil {
+		return Nautobotor{}, err
 	}
 
 	return n, nil
 }
+
+// singleArg returns the only argument of the directive
+func singleArg(c *caddy.Controller) (string, error) {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return "", c.ArgErr()
+	}
+	return args[0], nil
+}
+
+// parseZoneConfig parse nameserver and SOA directives
+// used globally and inside the zone block
+func parseZoneConfig(c *caddy.Controller, zc *ramrecords.ZoneConfig) error {
+	switch c.Val() {
+	case "nameserver":
+		// nameserver NAME [IPv4] [IPv6]
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 3 {
+			return c.ArgErr()
+		}
+		ns := ramrecords.NameServer{Name: args[0]}
+		if _, ok := dns.IsDomainName(ns.Name); !ok {
+			return c.Errf("invalid nameserver name '%s'", ns.Name)
+		}
+		for _, a := range args[1:] {
+			ip := net.ParseIP(a)
+			switch {
+			case ip == nil:
+				return c.Errf("invalid nameserver address '%s'", a)
+			case ip.To4() != nil:
+				ns.IPv4 = ip
+			default:
+				ns.IPv6 = ip
+			}
+		}
+		zc.NS = append(zc.NS, ns)
+
+	case "soa":
+		// soa MNAME RNAME
+		args := c.RemainingArgs()
+		if len(args) != 2 {
+			return c.ArgErr()
+		}
+		for _, a := range args {
+			if _, ok := dns.IsDomainName(a); !ok {
+				return c.Errf("invalid SOA name '%s'", a)
+			}
+		}
+		zc.SOA.Mname, zc.SOA.Rname = args[0], args[1]
+
+	case "soa_timers":
+		// soa_timers REFRESH RETRY EXPIRE MINIMUM
+		args := c.RemainingArgs()
+		if len(args) != 4 {
+			return c.ArgErr()
+		}
+		timers := make([]uint32, len(args))
+		for i, a := range args {
+			t, err := strconv.ParseUint(a, 10, 32)
+			if err != nil || t == 0 {
+				return c.Errf("invalid SOA timer '%s'", a)
+			}
+			timers[i] = uint32(t)
+		}
+		zc.SOA.Refresh, zc.SOA.Retry, zc.SOA.Expire, zc.SOA.Minttl = timers[0], timers[1], timers[2], timers[3]
+
+	default:
+		return c.Errf("unknown zone property '%s'", c.Val())
+	}
+
+	return nil
+}
+
+// parseZoneBlock parse per-zone overrides
+//
+//	zone ZONE {
+//	    nameserver NAME [IPv4] [IPv6]
+//	    soa MNAME RNAME
+//	    soa_timers REFRESH RETRY EXPIRE MINIMUM
+//	}
+func parseZoneBlock(c *caddy.Controller, cfg *ramrecords.Config) error {
+	if !c.NextArg() {
+		return c.ArgErr()
+	}
+	zone := strings.ToLower(dns.Fqdn(c.Val()))
+	if _, ok := dns.IsDomainName(zone); !ok {
+		return c.Errf("invalid zone '%s'", c.Val())
+	}
+
+	if !c.NextArg() || c.Val() != "{" {
+		return c.Err("expected '{' after zone name")
+	}
+
+	zc := cfg.Zones[zone]
+	for c.Next() {
+		if c.Val() == "}" {
+			cfg.Zones[zone] = zc
+			return nil
+		}
+		if err := parseZoneConfig(c, &zc); err != nil {
+			return err
+		}
+	}
+
+	return c.EOFErr()
+}
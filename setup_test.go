@@ -4,9 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
@@ -16,7 +24,75 @@ import (
 	"github.com/miekg/dns"
 )
 
+// testNameServers are name servers used by test Corefiles
+const testNameServers = `nameserver ans-m1 172.16.5.90
+nameserver arn-t1 172.16.5.76
+nameserver arn-x1 172.16.5.77
+soa ns noc-srv.lastmile.sk.
+`
+
+// newNautobotServer start fake nautobot API
+// serving results split into pages of pageSize
+func newNautobotServer(t *testing.T, results []nautobot.Results, pageSize int) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+		end := offset + pageSize
+		if end > len(results) {
+			end = len(results)
+		}
+
+		page := struct {
+			Count   int                `json:"count"`
+			Next    string             `json:"next"`
+			Results []nautobot.Results `json:"results"`
+		}{
+			Count:   len(results),
+			Results: append([]nautobot.Results{}, results[offset:end]...),
+		}
+		if end < len(results) {
+			page.Next = fmt.Sprintf("%s%s?limit=%d&offset=%d", srv.URL, r.URL.Path, pageSize, end)
+		}
+
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			t.Errorf("Unable encode nautobot page error = %s", err)
+		}
+	}))
+
+	return srv
+}
+
+// newTestClient returns nautobot client retrying without long backoff
+func newTestClient(t *testing.T) *nautobot.Client {
+	client, err := nautobot.NewClient(nautobot.ClientConfig{Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("nautobot.NewClient() error = %v", err)
+	}
+	return client
+}
+
+// newTestNautobotor returns Nautobotor serving zones of the config
+// with the addresses added by addAddress
+func newTestNautobotor(t *testing.T, cfg ramrecords.Config, addrs ...nautobot.Results) Nautobotor {
+	t.Helper()
+	rm, err := ramrecords.InitRamRecords(cfg)
+	if err != nil {
+		t.Fatalf("InitRamRecords() error = %v", err)
+	}
+
+	n := Nautobotor{RM: rm}
+	for _, a := range addrs {
+		if _, err := n.addAddress(a.Family.Value, a.Address, a.Dns_name); err != nil {
+			t.Fatalf("Nautobotor.addAddress() error = %v", err)
+		}
+	}
+	return n
+}
+
 func Test_newNautobotor(t *testing.T) {
+	srv := newNautobotServer(t, nil, 50)
+	defer srv.Close()
 
 	tests := []struct {
 		name    string
@@ -27,7 +103,7 @@ func Test_newNautobotor(t *testing.T) {
 	}{
 		{
 			name:  "Creating Record via webhook",
-			input: "nautobotor {\nwebaddress :9002\nnautoboturl  http://geriatrix.if.lastmile.sk/api/ipam/ip-addresses \ntoken d4c7513f5ab6a3d42a11ed579bd7cc16acdd4b05\n}\n",
+			input: "nautobotor {\nwebaddress :9002\nnautoboturl  " + srv.URL + "/api/ipam/ip-addresses \ntoken d4c7513f5ab6a3d42a11ed579bd7cc16acdd4b05\n" + testNameServers + "}\n",
 			want: Nautobotor{
 				WebAddress: ":9002",
 				RM: &ramrecords.RamRecord{
@@ -109,6 +185,7 @@ func Test_newNautobotor(t *testing.T) {
 			if err := got.onStartup(); (err != nil) != tt.wantErr {
 				t.Errorf("Nautobotor.onStartup() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			t.Cleanup(got.shutdown)
 
 			// Test Add records via webhook
 			address := fmt.Sprintf("http://%s%s", tt.want.WebAddress, "/webhook")
@@ -136,14 +213,634 @@ func Test_newNautobotor(t *testing.T) {
 	}
 }
 
+func TestSetup(t *testing.T) {
+	base := "webaddress :9100\nnautoboturl https://nautobot.test/api/ipam/ip-addresses/\ntoken abc\n" + testNameServers
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "Valid", input: "nautobotor {\n" + base + "}"},
+		{name: "Valid with options", input: "nautobotor {\n" + base + "webhook_secret s3cr3t\nresync 5m\nzone example.com {\nsoa_timers 1 2 3 4\n}\n}"},
+		{name: "Plugin arguments", input: "nautobotor extra {\n" + base + "}", wantErr: "Wrong argument count"},
+		{name: "Empty block", input: "nautobotor", wantErr: "webaddress is required"},
+		{name: "Unknown directive", input: "nautobotor {\n" + base + "nautobotur http://nautobot.test\n}", wantErr: "unknown property 'nautobotur'"},
+		{name: "Missing argument", input: "nautobotor {\nwebaddress\n" + base + "}", wantErr: "Wrong argument count"},
+		{name: "Too many arguments", input: "nautobotor {\n" + base + "token a b\n}", wantErr: "Wrong argument count"},
+		{name: "Invalid webaddress", input: "nautobotor {\n" + base + "webaddress 9100\n}", wantErr: "invalid webaddress"},
+		{name: "Invalid nautoboturl", input: "nautobotor {\n" + base + "nautoboturl nautobot.test/api\n}", wantErr: "invalid nautoboturl"},
+		{name: "Invalid nautoboturl scheme", input: "nautobotor {\n" + base + "nautoboturl ftp://nautobot.test/api\n}", wantErr: "invalid nautoboturl"},
+		{name: "Missing nautoboturl", input: "nautobotor {\nwebaddress :9100\n" + testNameServers + "}", wantErr: "nautoboturl is required"},
+		{name: "Valid journal", input: "nautobotor {\n" + base + "journal 0\n}"},
+		{name: "Invalid journal", input: "nautobotor {\n" + base + "journal -1\n}", wantErr: "invalid journal size"},
+		{name: "Valid serial", input: "nautobotor {\n" + base + "serial unixtime\n}"},
+		{name: "Invalid serial", input: "nautobotor {\n" + base + "serial random\n}", wantErr: "unknown serial policy"},
+		{name: "Valid notify", input: "nautobotor {\n" + base + "notify 192.0.2.10 [2001:db8::10]:5353\n}"},
+		{name: "Missing notify address", input: "nautobotor {\n" + base + "notify\n}", wantErr: "Wrong argument count"},
+		{name: "Valid zone_export", input: "nautobotor {\n" + base + "zone_export s3cr3t 192.0.2.0/24 2001:db8::/32\n}"},
+		{name: "Missing zone_export token", input: "nautobotor {\n" + base + "zone_export\n}", wantErr: "Wrong argument count"},
+		{name: "Invalid zone_export network", input: "nautobotor {\n" + base + "zone_export s3cr3t 192.0.2.1\n}", wantErr: "invalid zone_export network"},
+		{name: "Valid snapshot", input: "nautobotor {\n" + base + "snapshot " + os.TempDir() + "/nautobotor.snapshot\n}"},
+		{name: "Invalid snapshot", input: "nautobotor {\n" + base + "snapshot /nonexistent/nautobotor/snapshot\n}", wantErr: "invalid snapshot path"},
+		{name: "Valid statuses", input: "nautobotor {\n" + base + "statuses active DHCP\n}"},
+		{name: "Missing statuses", input: "nautobotor {\n" + base + "statuses\n}", wantErr: "Wrong argument count"},
+		{name: "Valid record", input: "nautobotor {\n" + base + "record cname custom_field dns_aliases\nrecord TXT tag txt:\n}"},
+		{name: "Unsupported record type", input: "nautobotor {\n" + base + "record ptr custom_field dns_ptr\n}", wantErr: "unsupported record type"},
+		{name: "Unknown record source", input: "nautobotor {\n" + base + "record mx field dns_mx\n}", wantErr: "unknown record source"},
+		{name: "Valid zones", input: "nautobotor {\n" + base + "zones example.com example.org.\n}"},
+		{name: "Missing zones", input: "nautobotor {\n" + base + "zones\n}", wantErr: "Wrong argument count"},
+		{name: "Invalid zones", input: "nautobotor {\n" + base + "zones bad..zone\n}", wantErr: "invalid zone"},
+		{name: "Valid reverse", input: "nautobotor {\n" + base + "reverse 10.0.0.0/8 192.0.2.64/26 2001:db8::/48\n}"},
+		{name: "Invalid reverse prefix", input: "nautobotor {\n" + base + "reverse 10.0.0.0\n}", wantErr: "invalid reverse prefix"},
+		{name: "Invalid reverse boundary", input: "nautobotor {\n" + base + "reverse 10.16.0.0/12\n}", wantErr: "isn't on octet boundary"},
+		{name: "Valid client options", input: "nautobotor {\n" + base + "timeout 10s\nretries 5 500ms\nproxy http://proxy.test:3128\n}"},
+		{name: "Disabled retries", input: "nautobotor {\n" + base + "retries 0\n}"},
+		{name: "Invalid timeout", input: "nautobotor {\n" + base + "timeout 0s\n}", wantErr: "invalid timeout"},
+		{name: "Invalid retries", input: "nautobotor {\n" + base + "retries -1\n}", wantErr: "invalid retries"},
+		{name: "Invalid retry backoff", input: "nautobotor {\n" + base + "retries 3 soon\n}", wantErr: "invalid retry backoff"},
+		{name: "Missing CA bundle", input: "nautobotor {\n" + base + "ca_cert /nonexistent/ca.pem\n}", wantErr: "unable read CA bundle"},
+		{name: "Missing client key", input: "nautobotor {\n" + base + "client_cert /nonexistent/cert.pem\n}", wantErr: "Wrong argument count"},
+		{name: "Missing client certificate", input: "nautobotor {\n" + base + "client_cert /nonexistent/cert.pem /nonexistent/key.pem\n}", wantErr: "unable load client certificate"},
+		{name: "Invalid proxy", input: "nautobotor {\n" + base + "proxy proxy.test\n}", wantErr: "invalid proxy"},
+		{name: "Valid filter", input: "nautobotor {\n" + base + "filter tag dns\nfilter tenant acme other\nfilter parent 10.0.0.0/8\n}"},
+		{name: "Missing filter value", input: "nautobotor {\n" + base + "filter tag\n}", wantErr: "Wrong argument count"},
+		{name: "Unknown filter", input: "nautobotor {\n" + base + "filter site dc1\n}", wantErr: "unknown filter"},
+		{name: "Invalid resync", input: "nautobotor {\n" + base + "resync often\n}", wantErr: "invalid resync interval"},
+		{name: "Missing nameserver", input: "nautobotor {\nwebaddress :9100\nnautoboturl http://nautobot.test\n}"},
+		{name: "Invalid nameserver address", input: "nautobotor {\n" + base + "nameserver ns3 300.1.1.1\n}", wantErr: "invalid nameserver address"},
+		{name: "Invalid SOA timer", input: "nautobotor {\n" + base + "soa_timers 1 2 3 x\n}", wantErr: "invalid SOA timer"},
+		{name: "Unknown zone directive", input: "nautobotor {\n" + base + "zone example.com {\ntoken abc\n}\n}", wantErr: "unknown zone property 'token'"},
+		{name: "Unclosed zone block", input: "nautobotor {\n" + base + "zone example.com {\nsoa ns admin\n", wantErr: "Unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setup(caddy.NewTestController("dns", tt.input))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("setup() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("setup() expected error containing %q", tt.wantErr)
+			}
+			if !strings.HasPrefix(err.Error(), "plugin/Nautobotor") || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("setup() error = %q, want plugin error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestZoneConfig(t *testing.T) {
+	input := `nautobotor {
+webaddress :0
+nautoboturl http://nautobot.test/api/ipam/ip-addresses/
+nameserver ns1.example.net. 192.0.2.1 2001:db8::1
+nameserver ns2 192.0.2.2
+soa ns1.example.net. hostmaster.example.net.
+soa_timers 3600 600 86400 300
+zone override.test. {
+	nameserver ns.override.test. 10.6.6.53
+	soa ns.override.test. admin
+	soa_timers 1800 300 604800 60
+}
+}`
+	n, err := newNautobotor(caddy.NewTestController("dns", input))
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+
+	n.addAddress(4, "10.6.6.1/24", "host.default.test.")
+	n.addAddress(4, "10.6.6.2/24", "host.override.test.")
+
+	tests := []struct {
+		zone    string
+		mname   string
+		rname   string
+		refresh uint32
+		minttl  uint32
+		ns      []string
+	}{
+		{zone: "default.test.", mname: "ns1.example.net.", rname: "hostmaster.example.net.", refresh: 3600, minttl: 300, ns: []string{"ns1.example.net.", "ns2.default.test."}},
+		{zone: "override.test.", mname: "ns.override.test.", rname: "admin.override.test.", refresh: 1800, minttl: 60, ns: []string{"ns.override.test."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			var ns []string
+			for _, rr := range n.RM.Snapshot().M[tt.zone] {
+				switch r := rr.(type) {
+				case *dns.SOA:
+					if r.Ns != tt.mname || r.Mbox != tt.rname || r.Refresh != tt.refresh || r.Minttl != tt.minttl {
+						t.Errorf("Unexpected SOA, got %s", r)
+					}
+				case *dns.NS:
+					ns = append(ns, r.Ns)
+				}
+			}
+			if strings.Join(ns, " ") != strings.Join(tt.ns, " ") {
+				t.Errorf("Expected NS %v, got %v", tt.ns, ns)
+			}
+		})
+	}
+
+	// Glue only for in-zone name servers
+	testDNSQuestion(t, n, "A", "ns2.default.test.", "192.0.2.2")
+	testDNSQuestion(t, n, "A", "ns.override.test.", "10.6.6.53")
+	for _, rr := range n.RM.Snapshot().M["default.test."] {
+		if rr.Header().Name == "ns1.example.net." {
+			t.Errorf("Unexpected out-of-zone glue %s", rr)
+		}
+	}
+}
+
+func TestLegacyNameServers(t *testing.T) {
+	n, err := newNautobotor(caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl http://nautobot.test\n}"))
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+	n.addAddress(4, "10.6.7.1/24", "host.legacy.test.")
+
+	var ns []string
+	for _, rr := range n.RM.Snapshot().M["legacy.test."] {
+		switch r := rr.(type) {
+		case *dns.SOA:
+			if r.Ns != "ns.legacy.test." || r.Mbox != "noc-srv.lastmile.sk." {
+				t.Errorf("Unexpected SOA %s", r)
+			}
+		case *dns.NS:
+			ns = append(ns, r.Ns)
+		}
+	}
+	sort.Strings(ns)
+	if strings.Join(ns, " ") != "ans-m1.legacy.test. arn-t1.legacy.test. arn-x1.legacy.test." {
+		t.Errorf("Expected built-in name servers, got %v", ns)
+	}
+	testDNSQuestion(t, n, "A", "ans-m1.legacy.test.", "172.16.5.90")
+}
+
+func TestGetApiDataPagination(t *testing.T) {
+	var results []nautobot.Results
+	for i := 1; i <= 5; i++ {
+		results = append(results, nautobot.Results{
+			Family:   nautobot.Family{Value: 4},
+			Address:  fmt.Sprintf("10.1.1.%d/24", i),
+			Status:   nautobot.Status{Value: "active"},
+			Dns_name: fmt.Sprintf("host%d.page.test.", i),
+		})
+	}
+
+	srv := newNautobotServer(t, results, 2)
+	defer srv.Close()
+
+	n := Nautobotor{
+		NautobotURL: srv.URL + "/api/ipam/ip-addresses/",
+		RM:          ramrecords.New(),
+	}
+
+	ip, err := n.fetchAPIData()
+	if err != nil {
+		t.Fatalf("Nautobotor.fetchAPIData() error = %v", err)
+	}
+	if len(ip.Results) != len(results) || ip.Count != len(results) {
+		t.Fatalf("Expected %d results, got %d (count %d)", len(results), len(ip.Results), ip.Count)
+	}
+
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		testDNSQuestion(t, n, "A", fmt.Sprintf("host%d.page.test.", i), fmt.Sprintf("10.1.1.%d", i))
+	}
+}
+
+func TestGetApiDataIncomplete(t *testing.T) {
+	tests := []struct {
+		name string
+		next string
+	}{
+		{name: "Missing pages", next: "null"},
+		{name: "Pagination loop", next: `"%s/api/ipam/ip-addresses/?offset=0"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv *httptest.Server
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next := tt.next
+				if strings.Contains(next, "%s") {
+					next = fmt.Sprintf(next, srv.URL)
+				}
+				fmt.Fprintf(w, `{"count": 3, "next": %s, "results": [{"family": {"value": 4}, "address": "10.1.2.1/24", "dns_name": "a.incomplete.test"}]}`, next)
+			}))
+			defer srv.Close()
+
+			n := Nautobotor{NautobotURL: srv.URL + "/api/ipam/ip-addresses/?offset=0", RM: ramrecords.New()}
+			n.addAddress(4, "10.1.2.2/24", "b.incomplete.test")
+
+			if _, err := n.fetchAPIData(); !errors.Is(err, errIncompleteData) {
+				t.Errorf("Expected incomplete data error, got %v", err)
+			}
+			// Addresses missing in partial data are kept
+			if err := n.resync(); err == nil {
+				t.Error("Expected resync error")
+			}
+			if !hasAddress(n, "10.1.2.2") {
+				t.Errorf("Expected address kept, got %v", n.RM.Addresses())
+			}
+		})
+	}
+}
+
+func TestResync(t *testing.T) {
+	results := []nautobot.Results{
+		{Family: nautobot.Family{Value: 4}, Address: "10.2.2.1/24", Dns_name: "keep.resync.test."},
+		{Family: nautobot.Family{Value: 4}, Address: "10.2.2.2/24", Dns_name: "old.resync.test."},
+		{Family: nautobot.Family{Value: 4}, Address: "10.2.2.3/24", Dns_name: "gone.resync.test."},
+	}
+	srv := newNautobotServer(t, results, 50)
+	defer srv.Close()
+
+	n := Nautobotor{
+		NautobotURL: srv.URL,
+		RM:          ramrecords.New(),
+	}
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+
+	// Nautobot changed: one rename, one delete, one new address
+	changed := []nautobot.Results{
+		results[0],
+		{Family: nautobot.Family{Value: 4}, Address: "10.2.2.2/24", Dns_name: "new.resync.test."},
+		{Family: nautobot.Family{Value: 4}, Address: "10.2.2.4/24", Dns_name: "add.resync.test."},
+	}
+	added, removed, updated := n.reconcile(changed)
+	if added != 1 || removed != 1 || updated != 1 {
+		t.Errorf("Expected 1 added, 1 removed, 1 changed, got %d, %d, %d", added, removed, updated)
+	}
+
+	testDNSQuestion(t, n, "A", "keep.resync.test.", "10.2.2.1")
+	testDNSQuestion(t, n, "A", "new.resync.test.", "10.2.2.2")
+	testDNSQuestion(t, n, "PTR", "new.resync.test.", "10.2.2.2")
+	testDNSQuestion(t, n, "A", "add.resync.test.", "10.2.2.4")
+
+	for _, name := range []string{"old.resync.test.", "gone.resync.test."} {
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		n.ServeDNS(context.Background(), rec, r)
+		if rec.Msg.Rcode != dns.RcodeNameError {
+			t.Errorf("Expected NXDOMAIN for %s, got %s", name, dns.RcodeToString[rec.Msg.Rcode])
+		}
+	}
+
+	// Nothing changed, nothing to do
+	if added, removed, updated := n.reconcile(changed); added+removed+updated != 0 {
+		t.Errorf("Expected no changes, got %d, %d, %d", added, removed, updated)
+	}
+}
+
+func TestResyncSingleUpdate(t *testing.T) {
+	// results returns addresses of the names with the prefix
+	results := func(prefix string) []nautobot.Results {
+		r := make([]nautobot.Results, 0, 500)
+		for i := 0; i < 500; i++ {
+			r = append(r, nautobot.Results{Family: nautobot.Family{Value: 4}, Status: nautobot.Status{Value: "active"}, Address: fmt.Sprintf("10.41.%d.%d/24", i/250, i%250+1), Dns_name: fmt.Sprintf("%s%d.bulk.test.", prefix, i)})
+		}
+		return r
+	}
+	srv := newNautobotServer(t, results("host"), 100)
+	defer srv.Close()
+
+	c := caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl "+srv.URL+"\n"+testNameServers+"zones bulk.test\nserial dateserial\njournal 100\n}")
+	n, err := newNautobotor(c)
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+
+	// serials returns SOA serial of every zone
+	serials := func() map[string]uint32 {
+		s := make(map[string]uint32)
+		for zone, records := range n.RM.Snapshot().M {
+			for _, rr := range records {
+				if soa, ok := rr.(*dns.SOA); ok {
+					s[zone] = soa.Serial
+				}
+			}
+		}
+		return s
+	}
+	// checkSerials check that every existing zone was bumped at most once
+	checkSerials := func(before map[string]uint32) {
+		t.Helper()
+		for zone, serial := range serials() {
+			if old, ok := before[zone]; ok && serial-old > 1 {
+				t.Errorf("Expected serial of %s bumped at most once, got %d -> %d", zone, old, serial)
+			}
+			if got := len(n.RM.Snapshot().Journal[zone]); got > 1 {
+				t.Errorf("Expected at most one journal entry of %s, got %d", zone, got)
+			}
+		}
+	}
+
+	before := serials()
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+	checkSerials(before)
+	if len(n.RM.Addresses()) < 500 {
+		t.Errorf("Expected 500 addresses, got %d", len(n.RM.Addresses()))
+	}
+
+	// Rename of all addresses is single change of every zone
+	before = serials()
+	if _, _, changed := n.reconcile(results("renamed")); changed != 500 {
+		t.Errorf("Expected 500 changed addresses, got %d", changed)
+	}
+	for zone, serial := range serials() {
+		if serial != before[zone]+1 {
+			t.Errorf("Expected serial of %s bumped once, got %d -> %d", zone, before[zone], serial)
+		}
+	}
+}
+
+func TestResyncErrorResponse(t *testing.T) {
+	var code int32 = http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&code)))
+		json.NewEncoder(w).Encode(nautobot.APIIPaddress{
+			Count:   1,
+			Results: []nautobot.Results{{Family: nautobot.Family{Value: 4}, Address: "10.26.26.1/24", Dns_name: "a.status.test."}},
+		})
+	}))
+	defer srv.Close()
+
+	n := Nautobotor{NautobotURL: srv.URL, RM: ramrecords.New(), client: newTestClient(t)}
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+
+	// Error page must not be reconciled as empty nautobot
+	for _, c := range []int32{http.StatusForbidden, http.StatusBadGateway} {
+		atomic.StoreInt32(&code, c)
+		if err := n.resync(); err == nil {
+			t.Errorf("Expected resync error on status %d", c)
+		}
+		if !hasAddress(n, "10.26.26.1") {
+			t.Errorf("Expected address kept on status %d", c)
+		}
+	}
+}
+
+func TestShutdownInterruptsRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client, _ := nautobot.NewClient(nautobot.ClientConfig{Backoff: time.Hour})
+	n := Nautobotor{NautobotURL: srv.URL, RM: ramrecords.New(), client: client, stop: make(chan struct{})}
+	time.AfterFunc(50*time.Millisecond, n.shutdown)
+
+	start := time.Now()
+	if err := n.getApiData(); err == nil {
+		t.Error("Expected error of unavailable nautobot")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Expected retries interrupted by shutdown, took %s", d)
+	}
+}
+
+func TestShutdownClosesWebServer(t *testing.T) {
+	n := Nautobotor{WebAddress: "127.0.0.1:0", RM: ramrecords.New(), stop: make(chan struct{})}
+	if err := n.onStartup(); err != nil {
+		t.Fatalf("Nautobotor.onStartup() error = %v", err)
+	}
+	address := "http://" + n.ln.Addr().String() + "/health"
+	if resp, err := http.Get(address); err != nil {
+		t.Fatalf("Expected web server running, got %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	// Reloaded instance doesn't accept webhooks anymore
+	n.shutdown()
+	if resp, err := http.Get(address); err == nil {
+		resp.Body.Close()
+		t.Error("Expected web server closed on shutdown")
+	}
+}
+
+func TestWithDepth(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://nautobot.test/api/ipam/ip-addresses/", want: "https://nautobot.test/api/ipam/ip-addresses/?depth=1"},
+		{url: "https://nautobot.test/api/ipam/ip-addresses/?limit=50", want: "https://nautobot.test/api/ipam/ip-addresses/?depth=1&limit=50"},
+		{url: "https://nautobot.test/api/ipam/ip-addresses/?depth=2", want: "https://nautobot.test/api/ipam/ip-addresses/?depth=2"},
+	}
+
+	for _, tt := range tests {
+		if got, err := withDepth(tt.url); err != nil || got != tt.want {
+			t.Errorf("withDepth(%s) = %s, %v, want %s", tt.url, got, err, tt.want)
+		}
+	}
+}
+
+func TestAddressStatus(t *testing.T) {
+	srv := newNautobotServer(t, []nautobot.Results{
+		{Family: nautobot.Family{Value: 4}, Address: "10.6.6.1/24", Status: nautobot.Status{Value: "active"}, Dns_name: "active.status.test."},
+		{Family: nautobot.Family{Value: 4}, Address: "10.6.6.2/24", Status: nautobot.Status{Value: "deprecated"}, Dns_name: "deprecated.status.test."},
+		{Family: nautobot.Family{Value: 4}, Address: "10.6.6.3/24", Status: nautobot.Status{Value: "DHCP"}, Dns_name: "dhcp.status.test."},
+		// Status returned only as reference
+		{Family: nautobot.Family{Value: 4}, Address: "10.6.6.4/24", Dns_name: "ref.status.test."},
+	}, 50)
+	defer srv.Close()
+
+	c := caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl "+srv.URL+"\n"+testNameServers+"statuses active dhcp\n}")
+	n, err := newNautobotor(c)
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+
+	testDNSQuestion(t, n, "A", "active.status.test.", "10.6.6.1")
+	testDNSQuestion(t, n, "A", "dhcp.status.test.", "10.6.6.3")
+	if !hasAddress(n, "10.6.6.1") || hasAddress(n, "10.6.6.2") || !hasAddress(n, "10.6.6.3") || hasAddress(n, "10.6.6.4") {
+		t.Errorf("Expected only active and dhcp addresses, got %v", n.RM.Addresses())
+	}
+
+	webhook := func(event, status string) {
+		t.Helper()
+		payload := fmt.Sprintf(`{"event": %q, "model": "ipaddress", "data": {"family": {"value": 4}, "address": "10.6.6.4/24", "status": {"value": %q}, "dns_name": "moved.status.test"}}`, event, status)
+		if code, res := postWebhook(t, n, payload); code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d %+v", code, res)
+		}
+	}
+
+	webhook("created", "reserved")
+	if hasAddress(n, "10.6.6.4") {
+		t.Error("Expected reserved address not to be published")
+	}
+	webhook("updated", "active")
+	if !hasAddress(n, "10.6.6.4") {
+		t.Error("Expected address moved to active to be published")
+	}
+	webhook("updated", "deprecated")
+	if hasAddress(n, "10.6.6.4") {
+		t.Error("Expected address moved to deprecated to be removed")
+	}
+}
+
+func TestCustomRecords(t *testing.T) {
+	c := caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl http://nautobot.test\n"+testNameServers+"record cname custom_field dns_aliases\nrecord mx tag mx:\n}")
+	n, err := newNautobotor(c)
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+
+	webhook := func(event, aliases string) (int, webhookResult) {
+		t.Helper()
+		payload := fmt.Sprintf(`{"event": %q, "model": "ipaddress", "data": {"family": {"value": 4}, "status": {"value": "active"}, "address": "10.7.7.1/24", "dns_name": "host.custom.test",
+			"tags": [{"name": "mx:custom.test 10", "slug": "mx-custom-test-10"}], "custom_fields": {"dns_aliases": %q}}}`, event, aliases)
+		return postWebhook(t, n, payload)
+	}
+
+	if code, res := webhook("created", "www.custom.test"); code != http.StatusOK || len(res.Added) == 0 {
+		t.Fatalf("Expected created records, got %d %+v", code, res)
+	}
+	testDNSQuestion(t, n, "A", "www.custom.test.", "10.7.7.1")
+	testDNSQuestion(t, n, "MX", "custom.test.", "host.custom.test.")
+
+	// Invalid alias is reported, valid records are kept
+	code, res := webhook("updated", "www.custom.test, bad..alias")
+	if code != http.StatusUnprocessableEntity || !strings.Contains(res.Error, "bad..alias") {
+		t.Errorf("Expected validation error, got %d %+v", code, res)
+	}
+	testDNSQuestion(t, n, "A", "www.custom.test.", "10.7.7.1")
+
+	// Custom records are removed with the address
+	if code, res := webhook("deleted", ""); code != http.StatusOK || len(res.Removed) != 4 {
+		t.Errorf("Expected removed A, PTR, CNAME and MX records, got %d %+v", code, res)
+	}
+}
+
+func TestCustomRecordsOfName(t *testing.T) {
+	c := caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl http://nautobot.test\n"+testNameServers+"record cname custom_field dns_aliases\n}")
+	n, err := newNautobotor(c)
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+
+	webhook := func(event, ip, aliases string) {
+		t.Helper()
+		payload := fmt.Sprintf(`{"event": %q, "model": "ipaddress", "data": {"family": {"value": 4}, "status": {"value": "active"}, "address": %q, "dns_name": "host.name.test",
+			"custom_fields": {"dns_aliases": %q}}}`, event, ip, aliases)
+		if code, res := postWebhook(t, n, payload); code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d %+v", code, res)
+		}
+	}
+	// aliases returns CNAME records pointing to the name
+	aliases := func() string {
+		var s []string
+		for _, rr := range n.RM.Snapshot().M["name.test."] {
+			if rr.Header().Rrtype == dns.TypeCNAME {
+				s = append(s, rr.Header().Name)
+			}
+		}
+		sort.Strings(s)
+		return strings.Join(s, ", ")
+	}
+
+	// Aliases of all addresses of the name are published
+	webhook("created", "10.7.8.1/24", "a.name.test")
+	webhook("created", "10.7.8.2/24", "b.name.test")
+	if got := aliases(); got != "a.name.test., b.name.test." {
+		t.Errorf("Expected aliases of both addresses, got %q", got)
+	}
+
+	// Change of one address keeps aliases of the other
+	webhook("updated", "10.7.8.1/24", "c.name.test")
+	if got := aliases(); got != "b.name.test., c.name.test." {
+		t.Errorf("Expected aliases of both addresses, got %q", got)
+	}
+
+	// Aliases of deleted address are removed, the others are kept
+	webhook("deleted", "10.7.8.2/24", "b.name.test")
+	if got := aliases(); got != "c.name.test." {
+		t.Errorf("Expected aliases of remaining address, got %q", got)
+	}
+
+	// Resync counts addresses, custom records aren't counted
+	added, removed, changed := n.reconcile([]nautobot.Results{
+		{Family: nautobot.Family{Value: 4}, Status: nautobot.Status{Value: "active"}, Address: "10.7.8.1/24", Dns_name: "host.name.test", Custom_fields: map[string]interface{}{"dns_aliases": "d.name.test"}},
+		{Family: nautobot.Family{Value: 4}, Status: nautobot.Status{Value: "active"}, Address: "10.7.8.3/24", Dns_name: "host.name.test", Custom_fields: map[string]interface{}{"dns_aliases": "e.name.test"}},
+	})
+	if added != 1 || removed != 0 || changed != 0 {
+		t.Errorf("Expected 1 added address, got %d, %d, %d", added, removed, changed)
+	}
+	if got := aliases(); got != "d.name.test., e.name.test." {
+		t.Errorf("Expected aliases of resynced addresses, got %q", got)
+	}
+}
+
+func TestAuthoritativeZones(t *testing.T) {
+	srv := newNautobotServer(t, []nautobot.Results{
+		{Family: nautobot.Family{Value: 4}, Status: nautobot.Status{Value: "active"}, Address: "10.8.8.1/24", Dns_name: "a.b.deep.test."},
+		{Family: nautobot.Family{Value: 4}, Status: nautobot.Status{Value: "active"}, Address: "10.8.8.2/24", Dns_name: "a.outside.test."},
+	}, 50)
+	defer srv.Close()
+
+	c := caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl "+srv.URL+"\n"+testNameServers+"zones deep.test\n}")
+	n, err := newNautobotor(c)
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+
+	testDNSQuestion(t, n, "A", "a.b.deep.test.", "10.8.8.1")
+	testDNSQuestion(t, n, "SOA", "deep.test.", "ns.deep.test.")
+	if hasAddress(n, "10.8.8.2") {
+		t.Error("Expected address outside of the zones skipped")
+	}
+
+	payload := `{"event": "created", "model": "ipaddress", "data": {"family": {"value": 4}, "status": {"value": "active"}, "address": "10.8.8.3/24", "dns_name": "b.outside.test"}}`
+	if code, _ := postWebhook(t, n, payload); code != http.StatusUnprocessableEntity || hasAddress(n, "10.8.8.3") {
+		t.Errorf("Expected address outside of the zones rejected, got %d", code)
+	}
+}
+
+// hasAddress check if the IP address is published
+func hasAddress(n Nautobotor, ip string) bool {
+	for _, a := range n.RM.Addresses() {
+		if a.Address == ip {
+			return true
+		}
+	}
+	return false
+}
+
 func reposEqual(t *testing.T, e, n Nautobotor) bool {
 	if e.WebAddress != n.WebAddress {
 		t.Errorf("webaddress is different. Expected %v, got %v", e, n)
 		return false
 	}
+	zones := n.RM.Snapshot().Zones
+	if len(zones) < len(e.RM.Zones) {
+		t.Errorf("zones are different. Expected %v, got %v", e.RM.Zones, zones)
+		return false
+	}
 	for i, r := range e.RM.Zones {
-		if r != n.RM.Zones[i] {
-			t.Errorf("zone is different. Expected %v, got %v", r, n.RM.Zones[i])
+		if r != zones[i] {
+			t.Errorf("zone is different. Expected %v, got %v", r, zones[i])
 			return false
 		}
 	}
@@ -183,6 +880,8 @@ func testDNSQuestion(t *testing.T, n Nautobotor, recordType, question, ip string
 		r.SetQuestion(question, dns.TypeA)
 	case "SOA":
 		r.SetQuestion(question, dns.TypeSOA)
+	case "MX":
+		r.SetQuestion(question, dns.TypeMX)
 	case "NS":
 		r.SetQuestion(question, dns.TypeNS)
 	case "PTR":
@@ -211,7 +910,8 @@ func testDNSQuestion(t *testing.T, n Nautobotor, recordType, question, ip string
 	// Set specific respon parser for different DNS questions
 	switch recordType {
 	case "A":
-		a := rec.Msg.Answer[0].(*dns.A).A.String()
+		// Alias is followed by the address
+		a := rec.Msg.Answer[len(rec.Msg.Answer)-1].(*dns.A).A.String()
 		if a != ip {
 			t.Errorf("Expected %v, got %v", ip, a)
 			return false
@@ -222,6 +922,12 @@ func testDNSQuestion(t *testing.T, n Nautobotor, recordType, question, ip string
 			t.Errorf("Expected %v, got %v", ip, soa)
 			return false
 		}
+	case "MX":
+		mx := rec.Msg.Answer[0].(*dns.MX).Mx
+		if mx != ip {
+			t.Errorf("Expected %v, got %v", ip, mx)
+			return false
+		}
 	case "NS":
 		ns := rec.Msg.Answer[0].Header().Name
 		if ns != question {
@@ -0,0 +1,271 @@
+package nautobotor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/jakubjastrabik/nautobotor/nautobot"
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+	"github.com/miekg/dns"
+)
+
+var (
+	// errUnsupportedEvent is returned for webhook event which can't be processed
+	errUnsupportedEvent = errors.New("unsupported event")
+	// errUnsupportedModel is returned for webhook of other model than IP address
+	errUnsupportedModel = errors.New("unsupported model")
+)
+
+// webhookResult is JSON response returned to nautobot webhook
+type webhookResult struct {
+	Event   string   `json:"event,omitempty"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// newWebhookResult convert changed records to webhook response
+func newWebhookResult(event string, changes *ramrecords.Changes) *webhookResult {
+	return &webhookResult{
+		Event:   event,
+		Added:   rrStrings(changes.Added),
+		Removed: rrStrings(changes.Removed),
+	}
+}
+
+// rrStrings convert records to presentation format
+func rrStrings(rrs []dns.RR) []string {
+	s := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		s = append(s, rr.String())
+	}
+	return s
+}
+
+// writeResult send JSON result of webhook with status code
+func writeResult(w http.ResponseWriter, code int, res *webhookResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Errorf("error writing webhook response: err=%s\n", err)
+	}
+}
+
+// webhookOutcome returns outcome label of webhook metric for the status code
+func webhookOutcome(code int) string {
+	switch code {
+	case http.StatusOK:
+		return "success"
+	case http.StatusBadRequest:
+		return "malformed"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusUnprocessableEntity:
+		return "unsupported"
+	default:
+		return "error"
+	}
+}
+
+// webhookEvent returns metric label of the event, events sent by nautobot
+// are kept and others are counted together to bound the label values
+func webhookEvent(event string) string {
+	switch event {
+	case "created", "updated", "deleted":
+		return event
+	default:
+		return "other"
+	}
+}
+
+// handleWebhook are used to processed nautobot webhook
+func (n *Nautobotor) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Start handling webhook data")
+
+	// Event is known only after the payload is parsed
+	event := "unknown"
+	reply := func(code int, res *webhookResult) {
+		webhookCount.WithLabelValues(event, webhookOutcome(code)).Inc()
+		writeResult(w, code, res)
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		reply(http.StatusMethodNotAllowed, &webhookResult{Error: "method not allowed"})
+		return
+	}
+
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf("error reading request body: err=%s\n", err)
+		reply(http.StatusBadRequest, &webhookResult{Error: err.Error()})
+		return
+	}
+	defer r.Body.Close()
+
+	// Verify nautobot signature, if webhook secret is configured
+	if n.WebhookSecret != "" && !nautobot.VerifySignature(n.WebhookSecret, payload, r.Header.Get(nautobot.SignatureHeader)) {
+		log.Warningf("Rejected webhook with invalid signature from %s", r.RemoteAddr)
+		webhookAuthFailures.Inc()
+		reply(http.StatusUnauthorized, &webhookResult{Error: "invalid signature"})
+		return
+	}
+
+	n.status.webhookReceived()
+
+	// Unmarshal data to strcut
+	ip, err := nautobot.NewIPaddress(payload)
+	if err != nil {
+		log.Errorf("error parsing webhook data: err=%s\n", err)
+		reply(http.StatusBadRequest, &webhookResult{Error: err.Error()})
+		return
+	}
+	if ip.Event != "" {
+		event = webhookEvent(ip.Event)
+	}
+
+	res, err := n.handleData(ip)
+	var recErr *ramrecords.RecordError
+	switch {
+	case errors.As(err, &recErr):
+		log.Warningf("Invalid custom records of %s: err=%s\n", ip.Data.Dns_name, err)
+		res.Error = err.Error()
+		reply(http.StatusUnprocessableEntity, res)
+	case errors.Is(err, errUnsupportedEvent), errors.Is(err, errUnsupportedModel), errors.Is(err, ramrecords.ErrNotAuthoritative):
+		log.Errorf("error handling DNS data: err=%s\n", err)
+		if res == nil {
+			res = &webhookResult{Event: ip.Event}
+		}
+		res.Error = err.Error()
+		reply(http.StatusUnprocessableEntity, res)
+	case err != nil:
+		log.Errorf("error handling DNS data: err=%s\n", err)
+		reply(http.StatusInternalServerError, &webhookResult{Event: ip.Event, Error: err.Error()})
+	default:
+		reply(http.StatusOK, res)
+	}
+}
+
+// handleData are used to handle incoming data structures
+// returning records changed in the zones
+func (n *Nautobotor) handleData(ip *nautobot.IPaddress) (*webhookResult, error) {
+	log.Debug("Start handling DNS record")
+	log.Debug("Unmarshaled data from webhook to be add to DNS: data=", ip)
+
+	if ip.Model != "" && ip.Model != "ipaddress" {
+		return nil, fmt.Errorf("%w: %s", errUnsupportedModel, ip.Model)
+	}
+
+	// All changes of the webhook are published by a single update
+	changes, err := n.RM.Batch(func(tx *ramrecords.Tx) error {
+		return n.applyData(tx, ip)
+	})
+
+	return newWebhookResult(ip.Event, changes), err
+}
+
+// applyData change the zones by the webhook event
+func (n *Nautobotor) applyData(tx *ramrecords.Tx, ip *nautobot.IPaddress) error {
+	switch ip.Event {
+	case "created":
+		log.Debug("Received webhook to creat")
+		if !n.published(ip.Data.Status.Value) || ip.Data.Dns_name == "" || !n.inScope(ip.Data) {
+			log.Debugf("Skip address %s with status %s and name %q", ip.Data.Address, ip.Data.Status.Value, ip.Data.Dns_name)
+			return nil
+		}
+		if err := tx.AddAddress(ip.Data.Family.Value, ip.Data.Address, ip.Data.Dns_name); err != nil {
+			return err
+		}
+		return n.setCustomRecords(tx, ip.Data)
+	case "deleted":
+		log.Debug("Received webhook to delet")
+		// Out of scope address may overlap with address of other VRF in scope
+		if !n.inScope(ip.Data) {
+			log.Debugf("Skip address %s out of scope", ip.Data.Address)
+			return nil
+		}
+		tx.RemoveAddress(ip.Data.Family.Value, ip.Data.Address, ip.Data.Dns_name)
+		return nil
+	case "updated":
+		log.Debug("Received webhook to update")
+		// Address without DNS name has no records
+		published := n.published(ip.Data.Status.Value) && ip.Data.Dns_name != "" && n.inScope(ip.Data)
+
+		// Remove exactly the records of the address before the change
+		if old := ip.Snapshots.Prechange; old != nil && n.inScope(*old) && (!published || !sameAddress(*old, ip.Data)) {
+			tx.RemoveAddress(old.Family.Value, old.Address, old.Dns_name)
+		}
+
+		// Address moved out of published statuses or scope, or lost its name
+		if !published {
+			switch {
+			case ip.Snapshots.Prechange != nil:
+				// Records before the change were already removed
+			case !n.inScope(ip.Data):
+				// Out of scope address may overlap with address of other VRF in scope,
+				// records left by the move are removed on resync
+				log.Debugf("Skip address %s out of scope", ip.Data.Address)
+			case ip.Data.Dns_name != "":
+				tx.RemoveAddress(ip.Data.Family.Value, ip.Data.Address, ip.Data.Dns_name)
+			default:
+				removeUnnamed(tx, ip.Data)
+			}
+			return nil
+		}
+
+		if ip.Snapshots.Prechange == nil {
+			// Without snapshot the old record is found by the address
+			if err := tx.UpdateRecord(ip.Data.Family.Value, ip.Data.Address, ip.Data.Dns_name); err != nil {
+				return err
+			}
+		} else {
+			// Address is added also when moved back to published status
+			if err := tx.AddAddress(ip.Data.Family.Value, ip.Data.Address, ip.Data.Dns_name); err != nil {
+				return err
+			}
+		}
+		return n.setCustomRecords(tx, ip.Data)
+	default:
+		return fmt.Errorf("%w: %q", errUnsupportedEvent, ip.Event)
+	}
+}
+
+// setCustomRecords set custom fields and tags of the address, records are
+// generated from the data of all addresses of the name
+func (n *Nautobotor) setCustomRecords(tx *ramrecords.Tx, data nautobot.Data) error {
+	return tx.SetAddressData(data.Dns_name, data.Address, ramrecords.RecordData{
+		CustomFields: data.Custom_fields,
+		Tags:         data.Tags.Names(),
+	})
+}
+
+// sameAddress check if both addresses publish the same records
+func sameAddress(a, b nautobot.Data) bool {
+	return a.Family.Value == b.Family.Value &&
+		addressIP(a.Address) == addressIP(b.Address) &&
+		strings.EqualFold(dns.Fqdn(a.Dns_name), dns.Fqdn(b.Dns_name))
+}
+
+// removeUnnamed remove records of address whose name was removed in nautobot,
+// with multiple names it isn't known which one was removed, they are kept until resync
+func removeUnnamed(tx *ramrecords.Tx, data nautobot.Data) {
+	var names []ramrecords.Address
+	for _, a := range tx.Addresses() {
+		if a.Address == addressIP(data.Address) && !a.Glue {
+			names = append(names, a)
+		}
+	}
+
+	if len(names) != 1 {
+		log.Debugf("address %s has %d names, keep them until resync", data.Address, len(names))
+		return
+	}
+	tx.RemoveAddress(names[0].Family, data.Address, names[0].DnsName)
+}
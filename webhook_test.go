@@ -0,0 +1,351 @@
+package nautobotor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/jakubjastrabik/nautobotor/nautobot"
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+	"github.com/miekg/dns"
+)
+
+// postWebhook send webhook payload to the plugin, return status and result
+func postWebhook(t *testing.T, n Nautobotor, payload string) (int, webhookResult) {
+	t.Helper()
+	return sendWebhook(t, n, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload)))
+}
+
+// sendWebhook send webhook request to the plugin, return status and result
+func sendWebhook(t *testing.T, n Nautobotor, req *http.Request) (int, webhookResult) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	n.handleWebhook(w, req)
+
+	var res webhookResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Unable unmarshal webhook response error = %s", err)
+	}
+	return w.Code, res
+}
+
+// snapshotPayload returns webhook payload with data and snapshots of the change
+func snapshotPayload(event, pre, post string) string {
+	return fmt.Sprintf(`{"event": %q, "model": "ipaddress", "data": %s, "snapshots": {"prechange": %s, "postchange": %s}}`, event, post, pre, post)
+}
+
+func TestWebhookSignature(t *testing.T) {
+	n := Nautobotor{
+		WebhookSecret: "secret",
+		RM:            ramrecords.New(),
+	}
+
+	payload, _ := json.Marshal(nautobot.IPaddress{
+		Event: "created",
+		Data: nautobot.Data{
+			Address:  "10.4.4.1/24",
+			Dns_name: "signed.hmac.test.",
+			Family:   nautobot.Family{Value: 4},
+		},
+	})
+	mac := hmac.New(sha512.New, []byte(n.WebhookSecret))
+	mac.Write(payload)
+
+	tests := []struct {
+		name      string
+		signature string
+		want      int
+	}{
+		{name: "Unsigned", signature: "", want: http.StatusUnauthorized},
+		{name: "Badly signed", signature: hex.EncodeToString([]byte("bad")), want: http.StatusUnauthorized},
+		{name: "Signed", signature: hex.EncodeToString(mac.Sum(nil)), want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBuffer(payload))
+			if tt.signature != "" {
+				req.Header.Set(nautobot.SignatureHeader, tt.signature)
+			}
+			w := httptest.NewRecorder()
+			n.handleWebhook(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+
+	testDNSQuestion(t, n, "A", "signed.hmac.test.", "10.4.4.1")
+}
+
+func TestWebhookStatus(t *testing.T) {
+	n := Nautobotor{
+		RM: ramrecords.New(),
+	}
+
+	created := `{"event": "created", "model": "ipaddress", "data": {"family": {"value": 4}, "address": "10.5.5.1/24", "dns_name": "status.webhook.test"}}`
+
+	tests := []struct {
+		name        string
+		method      string
+		payload     string
+		want        int
+		wantAdded   bool
+		wantRemoved bool
+	}{
+		{name: "Wrong method", method: http.MethodGet, want: http.StatusMethodNotAllowed},
+		{name: "Malformed payload", method: http.MethodPost, payload: `{"event": "created", "data": `, want: http.StatusBadRequest},
+		{name: "Unsupported event", method: http.MethodPost, payload: `{"event": "moved", "model": "ipaddress"}`, want: http.StatusUnprocessableEntity},
+		{name: "Unsupported model", method: http.MethodPost, payload: `{"event": "created", "model": "device"}`, want: http.StatusUnprocessableEntity},
+		{name: "Created", method: http.MethodPost, payload: created, want: http.StatusOK, wantAdded: true},
+		{name: "Deleted", method: http.MethodPost, payload: strings.Replace(created, "created", "deleted", 1), want: http.StatusOK, wantRemoved: true},
+		{name: "Invalid address", method: http.MethodPost, payload: strings.Replace(created, "10.5.5.1/24", "10.5.5.1", 1), want: http.StatusBadRequest},
+		{name: "Invalid name", method: http.MethodPost, payload: strings.Replace(created, "status.webhook.test", "status webhook", 1), want: http.StatusBadRequest},
+		{name: "Created without name", method: http.MethodPost, payload: strings.Replace(created, "status.webhook.test", "", 1), want: http.StatusOK},
+		{name: "Created again", method: http.MethodPost, payload: created, want: http.StatusOK, wantAdded: true},
+		{name: "Name removed", method: http.MethodPost, payload: strings.Replace(strings.Replace(created, "created", "updated", 1), "status.webhook.test", "", 1), want: http.StatusOK, wantRemoved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, res := sendWebhook(t, n, httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.payload)))
+			if code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, code)
+			}
+			if tt.want != http.StatusOK && res.Error == "" {
+				t.Errorf("Expected error in response, got %+v", res)
+			}
+			if (len(res.Added) > 0) != tt.wantAdded || (len(res.Removed) > 0) != tt.wantRemoved {
+				t.Errorf("Unexpected records in response, got %+v", res)
+			}
+		})
+	}
+}
+
+func TestWebhookSnapshots(t *testing.T) {
+	n := Nautobotor{RM: ramrecords.New(), Statuses: map[string]bool{"active": true}}
+
+	// address returns data of the address in webhook payload
+	address := func(family int, ip, status, name string) string {
+		return fmt.Sprintf(`{"family": {"value": %d}, "address": %q, "status": {"value": %q}, "dns_name": %q}`, family, ip, status, name)
+	}
+	webhook := func(event, pre, post string) {
+		t.Helper()
+		if code, res := postWebhook(t, n, snapshotPayload(event, pre, post)); code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d %+v", code, res)
+		}
+	}
+	// published returns all published addresses and names
+	published := func() string {
+		var s []string
+		for _, a := range n.RM.Addresses() {
+			s = append(s, a.Address+" "+a.DnsName)
+		}
+		sort.Strings(s)
+		return strings.Join(s, ", ")
+	}
+
+	// Other address with the same IP address keeps its records
+	webhook("created", "null", address(4, "10.9.9.1/24", "active", "other.snap.test"))
+
+	steps := []struct {
+		name string
+		pre  string
+		post string
+		want string
+	}{
+		{"Create", "null", address(4, "10.9.9.1/24", "active", "a.snap.test"), "10.9.9.1 a.snap.test., 10.9.9.1 other.snap.test."},
+		{"Rename", address(4, "10.9.9.1/24", "active", "a.snap.test"), address(4, "10.9.9.1/24", "active", "b.snap.test"), "10.9.9.1 b.snap.test., 10.9.9.1 other.snap.test."},
+		{"Change address", address(4, "10.9.9.1/24", "active", "b.snap.test"), address(4, "10.9.9.2/24", "active", "b.snap.test"), "10.9.9.1 other.snap.test., 10.9.9.2 b.snap.test."},
+		{"Change family", address(4, "10.9.9.2/24", "active", "b.snap.test"), address(6, "2001:db8::9/64", "active", "b.snap.test"), "10.9.9.1 other.snap.test., 2001:db8::9 b.snap.test."},
+		{"Deprecate", address(6, "2001:db8::9/64", "active", "b.snap.test"), address(6, "2001:db8::9/64", "deprecated", "c.snap.test"), "10.9.9.1 other.snap.test."},
+		{"Activate", address(6, "2001:db8::9/64", "deprecated", "c.snap.test"), address(6, "2001:db8::9/64", "active", "c.snap.test"), "10.9.9.1 other.snap.test., 2001:db8::9 c.snap.test."},
+	}
+
+	// Every webhook is published by single update
+	var updates int
+	n.RM.OnChange(func(zones []string) { updates++ })
+
+	for _, s := range steps {
+		event := "updated"
+		if s.pre == "null" {
+			event = "created"
+		}
+		updates = 0
+		webhook(event, s.pre, s.post)
+		if got := published(); got != s.want {
+			t.Errorf("%s: expected %q, got %q", s.name, s.want, got)
+		}
+		if updates != 1 {
+			t.Errorf("%s: expected single update, got %d", s.name, updates)
+		}
+	}
+
+	// Stale PTR records are removed with the old addresses
+	for _, ip := range []string{"10.9.9.2", "2001:db8::9"} {
+		rev, _ := dns.ReverseAddr(ip)
+		for _, records := range n.RM.Snapshot().M {
+			for _, rr := range records {
+				if ptr, ok := rr.(*dns.PTR); ok && rr.Header().Name == rev && ptr.Ptr != "c.snap.test." {
+					t.Errorf("Unexpected stale PTR %s", rr)
+				}
+			}
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		// Nautobot filters by VRF name, status is returned at depth 1, other nested objects are refs
+		results := []string{}
+		for _, vrf := range r.URL.Query()["vrf"] {
+			if vrf == "core" {
+				results = append(results, `{"ip_version": 4, "address": "10.31.1.1/24", "dns_name": "a.filter.test", "status": {"id": "5b7f2d1c-0000-4000-8000-000000000003", "name": "Active"},
+					"vrf": {"id": "5b7f2d1c-0000-4000-8000-000000000001", "object_type": "ipam.vrf", "url": "/api/ipam/vrfs/5b7f2d1c-0000-4000-8000-000000000001/"},
+					"tenant": {"id": "5b7f2d1c-0000-4000-8000-000000000002", "object_type": "tenancy.tenant", "url": "/api/tenancy/tenants/5b7f2d1c-0000-4000-8000-000000000002/"}}`)
+			}
+		}
+		fmt.Fprintf(w, `{"count": %d, "next": null, "results": [%s]}`, len(results), strings.Join(results, ","))
+	}))
+	defer srv.Close()
+
+	c := caddy.NewTestController("dns", "nautobotor {\nwebaddress :0\nnautoboturl "+srv.URL+"/api/ipam/ip-addresses/?limit=50\n"+testNameServers+"filter vrf core\nfilter VRF global\n}")
+	n, err := newNautobotor(c)
+	if err != nil {
+		t.Fatalf("newNautobotor() error = %v", err)
+	}
+	if err := n.getApiData(); err != nil {
+		t.Fatalf("Nautobotor.getApiData() error = %v", err)
+	}
+	if query != "depth=1&limit=50&vrf=core&vrf=global" {
+		t.Errorf("Expected filter in query, got %q", query)
+	}
+	// Results filtered by nautobot aren't checked again
+	if !hasAddress(n, "10.31.1.1") {
+		t.Errorf("Expected addresses filtered by nautobot, got %v", n.RM.Addresses())
+	}
+	if err := n.resync(); err != nil {
+		t.Fatalf("Nautobotor.resync() error = %v", err)
+	}
+	if !hasAddress(n, "10.31.1.1") {
+		t.Errorf("Expected addresses kept by resync, got %v", n.RM.Addresses())
+	}
+
+	// data returns webhook data of the address in the VRF
+	data := func(ip, name, vrf string) string {
+		return fmt.Sprintf(`{"family": {"value": 4}, "status": {"value": "active"}, "address": %q, "dns_name": %q, "vrf": {"name": %q}}`, ip, name, vrf)
+	}
+	webhook := func(event, pre, post string) {
+		t.Helper()
+		if code, res := postWebhook(t, n, snapshotPayload(event, pre, post)); code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d %+v", code, res)
+		}
+	}
+
+	webhook("created", "null", data("10.31.1.3/24", "c.filter.test", "lab"))
+	if hasAddress(n, "10.31.1.3") {
+		t.Error("Expected created address out of scope skipped")
+	}
+
+	// Overlapping address of other VRF doesn't remove address in scope
+	webhook("deleted", "null", data("10.31.1.1/24", "a.filter.test", "lab"))
+	if !hasAddress(n, "10.31.1.1") {
+		t.Error("Expected address in scope kept")
+	}
+	webhook("updated", "null", data("10.31.1.1/24", "a.filter.test", "lab"))
+	if !hasAddress(n, "10.31.1.1") {
+		t.Error("Expected address in scope kept by update without snapshot")
+	}
+
+	// Address moved to other VRF is removed
+	webhook("updated", data("10.31.1.1/24", "a.filter.test", "core"), data("10.31.1.1/24", "a.filter.test", "lab"))
+	if hasAddress(n, "10.31.1.1") {
+		t.Error("Expected address moved out of scope removed")
+	}
+
+	webhook("updated", data("10.31.1.1/24", "a.filter.test", "lab"), data("10.31.1.1/24", "a.filter.test", "global"))
+	if !hasAddress(n, "10.31.1.1") {
+		t.Error("Expected address moved into scope added")
+	}
+}
+
+// TestConcurrentWebhookAndQueries should be run with -race
+func TestConcurrentWebhookAndQueries(t *testing.T) {
+	n := Nautobotor{
+		RM: ramrecords.New(),
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	// Webhook mutations
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				for _, event := range []string{"created", "updated", "deleted"} {
+					ip := nautobot.IPaddress{
+						Event: event,
+						Data: nautobot.Data{
+							Address:  fmt.Sprintf("10.3.%d.%d/24", w, i),
+							Dns_name: fmt.Sprintf("host%d.stress%d.test.", i, w),
+							Family:   nautobot.Family{Value: 4},
+						},
+					}
+					payload, _ := json.Marshal(ip)
+					req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBuffer(payload))
+					n.handleWebhook(httptest.NewRecorder(), req)
+				}
+			}
+		}(w)
+	}
+
+	// DNS queries
+	var readers sync.WaitGroup
+	for q := 0; q < 4; q++ {
+		readers.Add(1)
+		go func(q int) {
+			defer readers.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				r := new(dns.Msg)
+				r.SetQuestion(fmt.Sprintf("host%d.stress%d.test.", i%50, q), dns.TypeA)
+				n.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+
+				a, _ := dns.ReverseAddr(fmt.Sprintf("10.3.%d.%d", q, i%50))
+				r.SetQuestion(a, dns.TypePTR)
+				n.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+			}
+		}(q)
+	}
+
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	// Every address was deleted at the end
+	if addrs := n.RM.Addresses(); len(addrs) != 0 {
+		t.Errorf("Expected no addresses, got %v", addrs)
+	}
+}
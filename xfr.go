@@ -0,0 +1,58 @@
+package nautobotor
+
+import (
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/miekg/dns"
+)
+
+// Transfer implements the transfer.Transferer interface.
+func (n Nautobotor) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
+	// Snapshot keeps the transfer consistent, even if webhook change the zone meanwhile
+	snap := n.RM.Snapshot()
+	records, ok := snap.M[zone]
+	if !ok {
+		return nil, transfer.ErrNotAuthoritative
+	}
+
+	var soa *dns.SOA
+	rrs := make([]dns.RR, 0, len(records))
+	for _, r := range records {
+		if s, ok := r.(*dns.SOA); ok {
+			if soa == nil {
+				soa = s
+			}
+			continue
+		}
+		rrs = append(rrs, r)
+	}
+	if soa == nil {
+		return nil, transfer.ErrNotAuthoritative
+	}
+
+	ch := make(chan []dns.RR)
+	go func() {
+		defer close(ch)
+
+		// Secondary is up to date, only send SOA
+		if serial != 0 && int32(soa.Serial-serial) <= 0 {
+			ch <- []dns.RR{soa}
+			return
+		}
+
+		// Send only changes, if serial is still in the journal
+		if serial != 0 {
+			if ixfr, ok := snap.IXFR(zone, serial); ok {
+				ch <- ixfr
+				return
+			}
+		}
+
+		ch <- []dns.RR{soa}
+		if len(rrs) > 0 {
+			ch <- rrs
+		}
+		ch <- []dns.RR{soa}
+	}()
+
+	return ch, nil
+}
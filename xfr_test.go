@@ -0,0 +1,153 @@
+package nautobotor
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/jakubjastrabik/nautobotor/nautobot"
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+	"github.com/miekg/dns"
+)
+
+// transferConfig keeps journal of two changes
+var transferConfig = ramrecords.Config{
+	Default: ramrecords.ZoneConfig{
+		NS: []ramrecords.NameServer{{Name: "ns1"}},
+	},
+	Journal: 2,
+}
+
+// transferAddresses are addresses of the transferred zones
+var transferAddresses = []nautobot.Results{
+	{Family: nautobot.Family{Value: 4}, Address: "10.7.7.1/24", Dns_name: "a.xfr.test."},
+	{Family: nautobot.Family{Value: 4}, Address: "10.7.7.2/24", Dns_name: "b.xfr.test."},
+	{Family: nautobot.Family{Value: 6}, Address: "2001:db8::7/64", Dns_name: "c.xfr.test."},
+}
+
+func transferRecords(t *testing.T, n Nautobotor, zone string, serial uint32) []dns.RR {
+	ch, err := n.Transfer(zone, serial)
+	if err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+
+	var rrs []dns.RR
+	for records := range ch {
+		rrs = append(rrs, records...)
+	}
+	return rrs
+}
+
+func TestTransferAXFR(t *testing.T) {
+	n := newTestNautobotor(t, transferConfig, transferAddresses...)
+
+	rrs := transferRecords(t, n, "xfr.test.", 0)
+
+	if _, ok := rrs[0].(*dns.SOA); !ok {
+		t.Fatalf("Expected SOA at the start of the transfer, got %s", rrs[0])
+	}
+	if _, ok := rrs[len(rrs)-1].(*dns.SOA); !ok {
+		t.Fatalf("Expected SOA at the end of the transfer, got %s", rrs[len(rrs)-1])
+	}
+
+	// SOA twice, NS, A, A, AAAA
+	if len(rrs) != 6 {
+		t.Errorf("Expected 6 records, got %d: %v", len(rrs), rrs)
+	}
+	want := map[uint16]int{dns.TypeSOA: 2, dns.TypeNS: 1, dns.TypeA: 2, dns.TypeAAAA: 1}
+	got := make(map[uint16]int)
+	for _, rr := range rrs {
+		got[rr.Header().Rrtype]++
+	}
+	for rrtype, count := range want {
+		if got[rrtype] != count {
+			t.Errorf("Expected %d %s records, got %d", count, dns.TypeToString[rrtype], got[rrtype])
+		}
+	}
+
+	// Reverse zones are transferred as well
+	if rrs := transferRecords(t, n, "7.7.10.in-addr.arpa.", 0); len(rrs) != 5 {
+		t.Errorf("Expected 5 records in reverse zone, got %d: %v", len(rrs), rrs)
+	}
+}
+
+func TestTransferUpToDate(t *testing.T) {
+	n := newTestNautobotor(t, transferConfig, transferAddresses...)
+
+	soa := transferRecords(t, n, "xfr.test.", 0)[0].(*dns.SOA)
+
+	rrs := transferRecords(t, n, "xfr.test.", soa.Serial)
+	if len(rrs) != 1 || rrs[0].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("Expected single SOA for up to date secondary, got %v", rrs)
+	}
+}
+
+func TestTransferNotAuthoritative(t *testing.T) {
+	n := newTestNautobotor(t, transferConfig, transferAddresses...)
+
+	if _, err := n.Transfer("example.org.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("Expected ErrNotAuthoritative, got %v", err)
+	}
+}
+
+func TestTransferIXFR(t *testing.T) {
+	n := newTestNautobotor(t, transferConfig, transferAddresses...)
+
+	from := transferRecords(t, n, "xfr.test.", 0)[0].(*dns.SOA).Serial
+
+	n.addAddress(4, "10.7.7.3/24", "d.xfr.test.")
+	n.removeAddress(4, "10.7.7.1/24", "a.xfr.test.")
+
+	rrs := transferRecords(t, n, "xfr.test.", from)
+
+	// SOA(new), SOA(from), SOA(from+1), A(d), SOA(from+1), A(a), SOA(new), SOA(new)
+	want := []string{"SOA", "SOA", "SOA", "A", "SOA", "A", "SOA", "SOA"}
+	if len(rrs) != len(want) {
+		t.Fatalf("Expected %d records, got %d: %v", len(want), len(rrs), rrs)
+	}
+	for i, rr := range rrs {
+		if dns.TypeToString[rr.Header().Rrtype] != want[i] {
+			t.Errorf("Expected %s at position %d, got %s", want[i], i, rr)
+		}
+	}
+
+	serials := []uint32{from + 2, from, from + 1, from + 1, from + 2, from + 2}
+	var got []uint32
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			got = append(got, soa.Serial)
+		}
+	}
+	for i := range serials {
+		if got[i] != serials[i] {
+			t.Errorf("Expected serials %v, got %v", serials, got)
+			break
+		}
+	}
+	if rrs[3].(*dns.A).A.String() != "10.7.7.3" || rrs[5].(*dns.A).A.String() != "10.7.7.1" {
+		t.Errorf("Unexpected deltas %v", rrs)
+	}
+}
+
+func TestTransferIXFRFallback(t *testing.T) {
+	n := newTestNautobotor(t, transferConfig, transferAddresses...)
+
+	from := transferRecords(t, n, "xfr.test.", 0)[0].(*dns.SOA).Serial
+
+	// Journal keeps only two changes
+	n.addAddress(4, "10.7.7.3/24", "d.xfr.test.")
+	n.addAddress(4, "10.7.7.4/24", "e.xfr.test.")
+	n.addAddress(4, "10.7.7.5/24", "f.xfr.test.")
+
+	rrs := transferRecords(t, n, "xfr.test.", from)
+
+	// AXFR: SOA twice, NS, 5 A, AAAA
+	if len(rrs) != 9 {
+		t.Fatalf("Expected AXFR fallback with 9 records, got %d: %v", len(rrs), rrs)
+	}
+	if soa := rrs[0].(*dns.SOA); soa.Serial != from+3 {
+		t.Errorf("Expected serial %d, got %d", from+3, soa.Serial)
+	}
+	if _, ok := rrs[1].(*dns.SOA); ok {
+		t.Errorf("Expected AXFR, got IXFR %v", rrs)
+	}
+}
@@ -0,0 +1,83 @@
+package nautobotor
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+)
+
+// handleZones export zones as RFC 1035 master files,
+// /zones returns all zones, /zones/<zone> returns single zone
+func (n *Nautobotor) handleZones(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !n.exportAllowed(r.RemoteAddr) {
+		log.Warningf("Rejected zone export from %s", r.RemoteAddr)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if !n.exportAuthorized(r.Header.Get("Authorization")) {
+		log.Warningf("Rejected zone export with invalid token from %s", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	// Zones are rendered first, error can't be reported after the body is written
+	var buf bytes.Buffer
+	var err error
+	if zone := strings.Trim(strings.TrimPrefix(r.URL.Path, "/zones"), "/"); zone != "" {
+		err = n.RM.WriteZone(&buf, zone)
+	} else {
+		err = n.RM.WriteZones(&buf)
+	}
+
+	switch {
+	case errors.Is(err, ramrecords.ErrUnknownZone):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		log.Errorf("error exporting zones: err=%s\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := buf.WriteTo(w); err != nil {
+			log.Errorf("error writing zones: err=%s\n", err)
+		}
+	}
+}
+
+// exportAllowed check if remote address is in networks allowed to export zones
+func (n *Nautobotor) exportAllowed(remoteAddr string) bool {
+	if len(n.ExportAllow) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	for _, allowed := range n.ExportAllow {
+		if ip != nil && allowed.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// exportAuthorized check bearer token of zone export request
+func (n *Nautobotor) exportAuthorized(auth string) bool {
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if n.ExportToken == "" || token == auth {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(n.ExportToken)) == 1
+}
@@ -0,0 +1,64 @@
+package nautobotor
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jakubjastrabik/nautobotor/ramrecords"
+)
+
+func TestHandleZones(t *testing.T) {
+	_, allow, _ := net.ParseCIDR("192.0.2.0/24")
+	n := Nautobotor{RM: ramrecords.New(), ExportToken: "s3cr3t", ExportAllow: []*net.IPNet{allow}}
+	n.addAddress(4, "10.13.13.1/24", "a.export.test.")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		remote string
+		want   int
+		origin []string
+	}{
+		{name: "Missing token", method: http.MethodGet, path: "/zones", remote: "192.0.2.1:1234", want: http.StatusUnauthorized},
+		{name: "Invalid token", method: http.MethodGet, path: "/zones", token: "other", want: http.StatusUnauthorized},
+		{name: "Address not allowed", method: http.MethodGet, path: "/zones", token: "s3cr3t", remote: "198.51.100.1:1234", want: http.StatusForbidden},
+		{name: "All zones", method: http.MethodGet, path: "/zones", token: "s3cr3t", want: http.StatusOK, origin: []string{"$ORIGIN 13.13.10.in-addr.arpa.", "$ORIGIN export.test."}},
+		{name: "Single zone", method: http.MethodGet, path: "/zones/export.test.", token: "s3cr3t", want: http.StatusOK, origin: []string{"$ORIGIN export.test."}},
+		{name: "Zone without trailing dot", method: http.MethodGet, path: "/zones/export.test", token: "s3cr3t", want: http.StatusOK, origin: []string{"$ORIGIN export.test."}},
+		{name: "Unknown zone", method: http.MethodGet, path: "/zones/unknown.test.", token: "s3cr3t", want: http.StatusNotFound},
+		{name: "Wrong method", method: http.MethodPost, path: "/zones", want: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.remote != "" {
+				req.RemoteAddr = tt.remote
+			}
+			w := httptest.NewRecorder()
+			n.handleZones(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("Expected status %d, got %d", tt.want, w.Code)
+			}
+
+			var origin []string
+			for _, l := range strings.Split(w.Body.String(), "\n") {
+				if strings.HasPrefix(l, "$ORIGIN") {
+					origin = append(origin, l)
+				}
+			}
+			if strings.Join(origin, ",") != strings.Join(tt.origin, ",") {
+				t.Errorf("Expected %v, got %v", tt.origin, origin)
+			}
+		})
+	}
+}